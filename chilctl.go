@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/sodabrew/chilctl/cx34"
@@ -13,7 +17,26 @@ import (
 
 var (
 	ttyDevice      = flag.String("tty", "/dev/ttyUSB0", "Path to RS-4845 serial port.")
-	unitId         = flag.Int("unit", 1, "Device unit id number.")
+	baudRate       = flag.Int("baud", 9600, "Serial baud rate.")
+	parity         = flag.String("parity", "N", "Serial parity: N, E or O.")
+	stopBits       = flag.Int("stop-bits", 1, "Serial stop bits: 1 or 2.")
+	dataBits       = flag.Int("data-bits", 8, "Serial data bits.")
+	rs485          = flag.Bool("rs485", false, "Enable kernel RS-485 mode on the serial port, for adapters such as a Raspberry Pi UART with a MAX485.")
+	rs485RTSOnSend = flag.Bool("rs485-rts-on-send", true, "In RS-485 mode, drive RTS high while sending.")
+	rs485RTSAfter  = flag.Bool("rs485-rts-after-send", false, "In RS-485 mode, drive RTS high after sending.")
+	rs485Before    = flag.Duration("rs485-delay-before-send", 0, "In RS-485 mode, delay between raising RTS and sending.")
+	rs485After     = flag.Duration("rs485-delay-after-send", 0, "In RS-485 mode, delay between the end of sending and releasing RTS.")
+	rs485RxInTx    = flag.Bool("rs485-rx-during-tx", false, "In RS-485 mode, keep the receiver enabled while sending.")
+	autoDetect     = flag.Bool("autodetect", false, "Detect the serial baud rate and parity of the controller before connecting.")
+	address        = flag.String("addr", "", "Address of a Modbus TCP gateway, e.g. tcp://10.0.0.5:502. Overrides -tty.")
+	network        = flag.String("network", "", "Framing used with -addr: tcp (Modbus TCP) or rtu-over-tcp (ser2net, serial device servers). Defaults to the scheme of -addr.")
+	protocolMode   = flag.String("mode", string(cx34.Modbus), "Protocol used with the heat pump: modbus, or cx34text to listen to the controller's Omron CompoWay/F traffic without polling.")
+	unitFlag       = flag.String("unit", "1", "Device unit id number, or a comma-separated list of unit ids sharing the bus.")
+	timeout        = flag.Duration("timeout", 10*time.Second, "How long to wait for each response from the heat pump.")
+	retries        = flag.Int("retries", 2, "How many times to retry a request after a timeout or CRC error.")
+	verifyFlag     = flag.Bool("verify", false, "Read back each written setting and fail if the heat pump did not accept it.")
+	captureFile    = flag.String("capture", "", "Record all Modbus traffic to this file in the cx34 capture format, or as pcap for Wireshark if the name ends in .pcap.")
+	replayFile     = flag.String("replay", "", "Answer requests from a file recorded with -capture instead of the heat pump.")
 	rawFlag        = flag.Bool("raw", false, "Print the raw register values.")
 	setModeActive  = flag.Bool("active", false, "Set active mode.")
 	setModeStandby = flag.Bool("standby", false, "Set standby mode.")
@@ -30,30 +53,191 @@ const (
 
 func main() {
 	flag.Parse()
+	cmd, err := parseCommand(flag.Args())
+	if err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		glog.Exitf("%v", err)
+	}
 	if *versionFlag {
 		fmt.Printf("%s\n", version)
 		return
 	}
 
-	cxClient, err := cx34.Connect(&cx34.Params{
+	unitIds, err := parseUnitFlag(*unitFlag)
+	if err != nil {
+		glog.Errorf("error parsing -unit: %v", err)
+		return
+	}
+	params := &cx34.Params{
 		TTYDevice: *ttyDevice,
-		Mode:      cx34.Modbus,
-		UnitId:    *unitId,
-	})
+		BaudRate:  *baudRate,
+		DataBits:  *dataBits,
+		Parity:    *parity,
+		StopBits:  *stopBits,
+		RS485: cx34.RS485Config{
+			Enabled:         *rs485,
+			RTSOnSend:       *rs485RTSOnSend,
+			RTSAfterSend:    *rs485RTSAfter,
+			DelayBeforeSend: *rs485Before,
+			DelayAfterSend:  *rs485After,
+			RxDuringTx:      *rs485RxInTx,
+		},
+		Address:   *address,
+		Network:   cx34.Network(*network),
+		Mode:      cx34.Mode(*protocolMode),
+		UnitId:    unitIds[0],
+		Timeout:   *timeout,
+		Retry: cx34.RetryPolicy{
+			Attempts: *retries + 1,
+			Backoff:  100 * time.Millisecond,
+		},
+		VerifyWrites: *verifyFlag,
+	}
+	if *captureFile != "" {
+		f, err := os.Create(*captureFile)
+		if err != nil {
+			glog.Errorf("error creating capture file: %v", err)
+			return
+		}
+		defer f.Close()
+		if strings.HasSuffix(*captureFile, ".pcap") {
+			params.Capture = cx34.NewPcapWriter(f)
+		} else {
+			params.Capture = cx34.NewCaptureWriter(f)
+		}
+	}
+
+	if *autoDetect {
+		detected, err := cx34.AutoDetect(context.Background(), params)
+		if err != nil {
+			glog.Errorf("error detecting serial settings: %v", err)
+			return
+		}
+		fmt.Printf("Detected serial settings: -baud %d -data-bits %d -parity %s -stop-bits %d\n",
+			detected.BaudRate, detected.DataBits, detected.Parity, detected.StopBits)
+		params = detected
+	}
+
+	if cmd != nil {
+		cmd.run(params)
+		return
+	}
+
+	if len(unitIds) == 1 {
+		cxClient, err := connect(params)
+		if err != nil {
+			glog.Errorf("error connecting to CX34: %v", err)
+			return
+		}
+		defer cxClient.Close()
+		runUnit(cxClient, unitIds[0])
+		return
+	}
+
+	// Several units share one serial port, so they must share one connection.
+	bus, err := cx34.OpenBus(params)
 	if err != nil {
-		glog.Errorf("error connecting to CX34: %v", err)
+		glog.Errorf("error connecting to CX34 bus: %v", err)
 		return
 	}
+	defer bus.Close()
+	for _, unitId := range unitIds {
+		runUnit(bus.Client(unitId), unitId)
+	}
+	for unitId, stats := range bus.Stats() {
+		glog.Infof("unit %d: %d requests, %d errors (%d timeouts, %d CRC errors, %d exceptions), %v busy",
+			unitId, stats.Requests, stats.Errors, stats.Timeouts, stats.CRCErrors, stats.Exceptions, stats.Busy)
+	}
+}
+
+// command is a chilctl command other than the default of printing and
+// changing the state of the heat pump.
+type command struct {
+	// flags holds the flags of the command. The global flags are accepted
+	// after the command name too.
+	flags *flag.FlagSet
+	run   func(params *cx34.Params)
+}
+
+var commands = map[string]*command{
+	"scan":      {scanFlags, runScan},
+	"sniff":     {sniffFlags, runSniff},
+	"simulate":  {simFlags, func(params *cx34.Params) { runSimulate(params.UnitId) }},
+	"registers": {registersFlags, func(*cx34.Params) { runRegisters() }},
+}
+
+// parseCommand looks up the command named by args[0] and parses the flags
+// after it. It returns nil if args is empty.
+func parseCommand(args []string) (*command, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown command %q", args[0])
+	}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(cmd.flags.Output())
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s %s (global flags are also accepted):\n", os.Args[0], args[0])
+		cmd.flags.PrintDefaults()
+	}
+	add := func(f *flag.Flag) { fs.Var(f.Value, f.Name, f.Usage) }
+	cmd.flags.VisitAll(add)
+	flag.VisitAll(add)
+	if err := fs.Parse(args[1:]); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments after %s: %q", args[0], fs.Args())
+	}
+	return cmd, nil
+}
 
-	state, err := cxClient.ReadState()
+// connect returns a client for the heat pump, or for the capture named by
+// -replay.
+func connect(params *cx34.Params) (*cx34.Client, error) {
+	if *replayFile == "" {
+		return cx34.Connect(params)
+	}
+	f, err := os.Open(*replayFile)
 	if err != nil {
-		glog.Errorf("error getting CX34 state: %v", err)
+		return nil, err
+	}
+	defer f.Close()
+	replay, err := cx34.NewReplay(f)
+	if err != nil {
+		return nil, err
+	}
+	// Make the same requests as Connect, so that a capture replays from
+	// its start.
+	client := cx34.NewClient(replay, params)
+	if err := client.CheckConnection(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// runUnit prints the state of one heat pump and applies the settings given
+// by flags.
+func runUnit(cxClient *cx34.Client, unitId int) {
+	// The summary only needs the setpoints and sensors, which is much faster
+	// to read than the full register map.
+	var readOpts []cx34.ReadOption
+	if !*rawFlag {
+		readOpts = append(readOpts, cx34.WithGroups(cx34.Setpoints, cx34.Sensors))
+	}
+	state, err := cxClient.ReadState(readOpts...)
+	if err != nil {
+		glog.Errorf("error getting CX34 unit %d state: %v", unitId, err)
+		return
 	}
 
 	if *rawFlag {
 		fmt.Printf("%+v\n", state)
 	} else {
-		printState(state)
+		printState(state, unitId)
 	}
 
 	if *setModeActive && *setModeStandby {
@@ -61,6 +245,10 @@ func main() {
 		return
 	}
 
+	// Collect all requested changes so they are validated together and
+	// applied, or rolled back, as one.
+	settings := &cx34.Settings{}
+	wrote := false
 	if *setModeActive || *setModeStandby {
 		active := *setModeActive || !*setModeStandby
 		if active {
@@ -68,42 +256,41 @@ func main() {
 		} else {
 			fmt.Printf("Setting standby mode\n")
 		}
-		err := cxClient.SetOnOffMode(active)
-		if err != nil{
-			glog.Errorf("error parsing temperature: %v", err)
-			return
-		}
-
+		settings.On = &active
+		wrote = true
 	}
 
 	if *setCoolingTemp != "" {
 		temp, err := parseTemperatureFlag(*setCoolingTemp)
-		if err != nil{
+		if err != nil {
 			glog.Errorf("error parsing temperature: %v", err)
 			return
 		}
 		fmt.Printf("Setting cooling target temp to %.2f°F\n", temp.Fahrenheit())
-		cxClient.SetCoolingTemp(temp)
+		settings.CoolingTemp = &temp
+		wrote = true
 	}
 
 	if *setHeatingTemp != "" {
 		temp, err := parseTemperatureFlag(*setHeatingTemp)
-		if err != nil{
+		if err != nil {
 			glog.Errorf("error parsing temperature: %v", err)
 			return
 		}
 		fmt.Printf("Setting heating target temp to %.2f°F\n", temp.Fahrenheit())
-		cxClient.SetHeatingTemp(temp)
+		settings.HeatingTemp = &temp
+		wrote = true
 	}
 
 	if *setDHWTemp != "" {
-		temp, err := parseTemperatureFlag(*setHeatingTemp)
-		if err != nil{
+		temp, err := parseTemperatureFlag(*setDHWTemp)
+		if err != nil {
 			glog.Errorf("error parsing temperature: %v", err)
 			return
 		}
 		fmt.Printf("Setting DHW target temp to %.2f°F\n", temp.Fahrenheit())
-		cxClient.SetDomesticHotWaterTemp(temp)
+		settings.DHWTemp = &temp
+		wrote = true
 	}
 
 	if *setMode != "" {
@@ -125,15 +312,66 @@ func main() {
 		}
 
 		fmt.Printf("Setting mode to %s\n", mode)
-		cxClient.SetACMode(mode)
+		settings.Mode = &mode
+		wrote = true
+	}
+
+	if wrote {
+		if err := cxClient.ApplySettings(settings); err != nil {
+			glog.Errorf("error applying settings: %v", err)
+		}
+		printSetpoints(cxClient)
 	}
 
 	return
 }
 
-func parseTemperatureFlag(string) (units.Temperature, error) {
-	suffix := (*setCoolingTemp)[len(*setCoolingTemp)-1:]
-	floatVal, err := strconv.ParseFloat((*setCoolingTemp)[0:len(*setCoolingTemp)-1], 64)
+// printSetpoints reads back and prints the settings as the heat pump now
+// reports them.
+func printSetpoints(cxClient *cx34.Client) {
+	state, err := cxClient.ReadState(cx34.WithGroups(cx34.Setpoints))
+	if err != nil {
+		glog.Errorf("error reading back CX34 settings: %v", err)
+		return
+	}
+	fmt.Printf(
+`Confirmed settings:
+  Active: %t
+  Mode: %s
+  Cooling Target Temp: %.2f °F
+  Heating Target Temp: %.2f °F
+  Hot Water Target Temp: %.2f °F
+`,
+		state.OnOffMode(),
+		state.ACMode(),
+		state.ACCoolingTargetTemp().Fahrenheit(),
+		state.ACHeatingTargetTemp().Fahrenheit(),
+		state.DomesticHotWaterTargetTemp().Fahrenheit(),
+	)
+}
+
+// parseUnitFlag parses a comma-separated list of unit ids.
+func parseUnitFlag(value string) ([]int, error) {
+	var ids []int
+	for _, field := range strings.Split(value, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if id < 1 || id > 247 {
+			return nil, fmt.Errorf("unit id %d is out of range 1-247", id)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func parseTemperatureFlag(value string) (units.Temperature, error) {
+	if value == "" {
+		return units.Temperature(0), errors.New("empty temperature")
+	}
+	suffix := value[len(value)-1:]
+	floatVal, err := strconv.ParseFloat(value[0:len(value)-1], 64)
 	if err != nil{
 		return units.Temperature(0), err
 	}
@@ -151,7 +389,7 @@ func parseTemperatureFlag(string) (units.Temperature, error) {
 	return temp, nil
 }
 
-func printState(state *cx34.State) {
+func printState(state *cx34.State, unitId int) {
 	cop, running := state.COP()
 	runningStr := ""
 	if running {
@@ -162,7 +400,7 @@ func printState(state *cx34.State) {
 
 	fmt.Printf(
 `Summary for CX34 unit %d:
-  Mode: %d
+  Mode: %t
   Mode: %s
   COP: %.2f (%s)
   Power: %.2f Watts
@@ -176,7 +414,7 @@ func printState(state *cx34.State) {
   Pump Speed: %.2f l/s
   Useful Heat Rate: %s
 `,
-		*unitId,
+		unitId,
 		state.OnOffMode(),
 		state.ACMode(),
 		cop, runningStr,
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestParseCommandFlags(t *testing.T) {
+	defer func(interval time.Duration, timeout string) {
+		*sniffInterval = interval
+		flag.Set("timeout", timeout)
+	}(*sniffInterval, flag.Lookup("timeout").Value.String())
+
+	cmd, err := parseCommand([]string{"sniff", "-sniff-interval", "1m", "-timeout", "3s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd != commands["sniff"] {
+		t.Errorf("parsed the wrong command")
+	}
+	if *sniffInterval != time.Minute {
+		t.Errorf("-sniff-interval after the command: got %v, want 1m", *sniffInterval)
+	}
+	if *timeout != 3*time.Second {
+		t.Errorf("-timeout after the command: got %v, want 3s", *timeout)
+	}
+}
+
+func TestParseCommandErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"registers", "-bogus-flag"},
+		{"registers", "extra"},
+		{"scan", "-scan-first"},
+		{"bogus"},
+	} {
+		if cmd, ok := commands[args[0]]; ok {
+			cmd.flags.SetOutput(io.Discard)
+		}
+		if _, err := parseCommand(args); err == nil {
+			t.Errorf("parseCommand(%q) succeeded, want an error", args)
+		}
+	}
+}
+
+func TestParseCommandNone(t *testing.T) {
+	cmd, err := parseCommand(nil)
+	if cmd != nil || err != nil {
+		t.Errorf("parseCommand(nil) = %v, %v, want no command", cmd, err)
+	}
+}
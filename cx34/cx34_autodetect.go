@@ -0,0 +1,86 @@
+package cx34
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/golang/glog"
+)
+
+// Serial settings tried by AutoDetect, most likely first.
+var (
+	autoDetectBaudRates = []int{9600, 19200, 4800, 38400, 2400, 57600, 115200}
+	autoDetectFraming   = []struct {
+		parity   string
+		stopBits int
+	}{
+		{"N", 1},
+		{"E", 1},
+		{"O", 1},
+		{"N", 2},
+	}
+)
+
+// defaultAutoDetectTimeout is how long AutoDetect waits for an answer to
+// each probe, unless Params.Timeout says otherwise.
+const defaultAutoDetectTimeout = 300 * time.Millisecond
+
+// AutoDetect finds the serial settings of the controller on p.TTYDevice by
+// cycling through common baud rates and parity settings until unit
+// p.UnitId answers with a frame that passes its CRC check. It returns a copy
+// of p with BaudRate, DataBits, Parity and StopBits filled in.
+func AutoDetect(ctx context.Context, p *Params) (*Params, error) {
+	if p.Address != "" {
+		return nil, fmt.Errorf("serial settings can only be detected on a serial device, not %q", p.Address)
+	}
+	for _, baud := range autoDetectBaudRates {
+		for _, framing := range autoDetectFraming {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			candidate := *p
+			candidate.BaudRate = baud
+			candidate.DataBits = dataBits
+			candidate.Parity = framing.parity
+			candidate.StopBits = framing.stopBits
+			if candidate.Timeout == 0 {
+				candidate.Timeout = defaultAutoDetectTimeout
+			}
+			ok, err := probeSerial(&candidate)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				glog.Infof("detected %d baud, %d%s%d", baud, dataBits, framing.parity, framing.stopBits)
+				detected := candidate
+				detected.Timeout = p.Timeout
+				return &detected, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no valid response from unit %d on %s with any common serial settings", p.UnitId, p.TTYDevice)
+}
+
+// probeSerial sends one request with the serial settings in p. It reports
+// whether a valid response came back, and returns an error only if the
+// device could not be opened.
+func probeSerial(p *Params) (bool, error) {
+	handler := newSerialHandler(p)
+	if err := handler.Connect(); err != nil {
+		return false, fmt.Errorf("Connect failed: %w", err)
+	}
+	defer handler.Close()
+
+	_, err := modbus.NewClient(handler).ReadHoldingRegisters(OnOffMode.uint16(), 1)
+	err = classifyError(err)
+	var exception *ExceptionError
+	if err == nil || errors.As(err, &exception) {
+		// An exception response also passed its CRC check.
+		return true, nil
+	}
+	glog.V(1).Infof("no valid response at %d baud, %d%s%d: %v", p.BaudRate, p.DataBits, p.Parity, p.StopBits, err)
+	return false, nil
+}
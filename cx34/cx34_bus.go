@@ -0,0 +1,147 @@
+package cx34
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Bus is a connection to an RS-485 bus, or a gateway in front of one, that
+// is shared by several heat pumps with different unit IDs.
+//
+// The Clients returned by a Bus share its connection and its request queue,
+// so that only one request is on the bus at a time, and writes to any unit go
+// ahead of pending reads.
+type Bus struct {
+	conn   *conn
+	sched  *scheduler
+	params Params
+
+	mu    sync.Mutex
+	stats map[int]*UnitStats
+}
+
+// UnitStats counts the requests sent to one unit on a Bus.
+type UnitStats struct {
+	Requests   int
+	Errors     int
+	Timeouts   int
+	CRCErrors  int
+	Exceptions int
+	// Busy is the total time spent waiting for responses from the unit.
+	Busy        time.Duration
+	LastSuccess time.Time
+	LastError   error
+}
+
+// OpenBus opens the serial device or network address in p. p.UnitId is
+// ignored; use Client to address individual units.
+func OpenBus(p *Params) (*Bus, error) {
+	if p.Mode != Modbus {
+		return nil, fmt.Errorf("mode %q is not supported on a shared bus", p.Mode)
+	}
+	handler, err := newHandler(p)
+	if err != nil {
+		return nil, err
+	}
+	conn := newConn(handler, p)
+	if err := conn.connect(); err != nil {
+		return nil, fmt.Errorf("Connect failed: %w", err)
+	}
+	return &Bus{
+		conn:   conn,
+		sched:  newScheduler(),
+		params: *p,
+		stats:  make(map[int]*UnitStats),
+	}, nil
+}
+
+// Client returns a client for the heat pump with the given unit ID. The
+// client's Close method does nothing; close the Bus instead.
+func (b *Bus) Client(unitID int) *Client {
+	b.mu.Lock()
+	if _, ok := b.stats[unitID]; !ok {
+		b.stats[unitID] = &UnitStats{}
+	}
+	b.mu.Unlock()
+
+	c := NewClient(&busUnit{b, unitID}, &b.params)
+	c.sched = b.sched
+	return c
+}
+
+// Stats returns a copy of the statistics of every unit handed out by Client.
+func (b *Bus) Stats() map[int]UnitStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := make(map[int]UnitStats, len(b.stats))
+	for id, s := range b.stats {
+		stats[id] = *s
+	}
+	return stats
+}
+
+// Close closes the connection. Clients of the bus must not be used
+// afterwards.
+func (b *Bus) Close() error {
+	return b.conn.Close()
+}
+
+// do runs op on the shared connection, addressed to unitID, and records it
+// in the unit's statistics.
+func (b *Bus) do(unitID int, op func() ([]byte, error)) ([]byte, error) {
+	start := time.Now()
+	results, err := b.conn.do(uint8(unitID), op)
+	end := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.stats[unitID]
+	s.Requests++
+	s.Busy += end.Sub(start)
+	if err == nil {
+		s.LastSuccess = end
+		return results, nil
+	}
+	s.Errors++
+	s.LastError = err
+	err = classifyError(err)
+	var exception *ExceptionError
+	switch {
+	case errors.Is(err, ErrTimeout):
+		s.Timeouts++
+	case errors.Is(err, ErrCRCMismatch):
+		s.CRCErrors++
+	case errors.As(err, &exception):
+		s.Exceptions++
+	}
+	return results, err
+}
+
+// busUnit is the Transport of a Client returned by Bus.Client.
+type busUnit struct {
+	bus *Bus
+	id  int
+}
+
+// ReadHoldingRegisters implements Transport.
+func (u *busUnit) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	return u.bus.do(u.id, func() ([]byte, error) {
+		return u.bus.conn.client.ReadHoldingRegisters(address, quantity)
+	})
+}
+
+// WriteSingleRegister implements Transport.
+func (u *busUnit) WriteSingleRegister(address, value uint16) ([]byte, error) {
+	return u.bus.do(u.id, func() ([]byte, error) {
+		return u.bus.conn.client.WriteSingleRegister(address, value)
+	})
+}
+
+// WriteMultipleRegisters implements Transport.
+func (u *busUnit) WriteMultipleRegisters(address, quantity uint16, value []byte) ([]byte, error) {
+	return u.bus.do(u.id, func() ([]byte, error) {
+		return u.bus.conn.client.WriteMultipleRegisters(address, quantity, value)
+	})
+}
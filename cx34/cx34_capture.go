@@ -0,0 +1,199 @@
+package cx34
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// A capture records Modbus traffic as text, one frame per line:
+//
+//	# cx34 capture v1
+//	2026-01-02T15:04:05.123456789Z req 01030000007845e8
+//	2026-01-02T15:04:05.301234567Z resp 0103f0000100...
+//
+// Each line holds the time the frame was sent or received in RFC 3339
+// format with nanoseconds, its direction, and the frame in hex. The
+// direction is "req" for a request to a heat pump, "resp" for a response
+// from one, or "?" if it is not known. Frames are always Modbus RTU frames,
+// including slave address and CRC; traffic to Modbus TCP gateways is
+// converted. A request without a response means the heat pump did not
+// answer. Blank lines and lines starting with "#" are ignored.
+const captureHeader = "# cx34 capture v1"
+
+// Direction tells whether a frame is a request or a response.
+type Direction uint8
+
+// Valid Direction values.
+const (
+	DirectionUnknown Direction = iota
+	DirectionRequest
+	DirectionResponse
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionRequest:
+		return "req"
+	case DirectionResponse:
+		return "resp"
+	}
+	return "?"
+}
+
+func parseDirection(s string) (Direction, error) {
+	for _, d := range []Direction{DirectionUnknown, DirectionRequest, DirectionResponse} {
+		if s == d.String() {
+			return d, nil
+		}
+	}
+	return DirectionUnknown, fmt.Errorf("invalid direction %q", s)
+}
+
+// FrameWriter records Modbus RTU frames.
+type FrameWriter interface {
+	WriteFrame(t time.Time, dir Direction, adu []byte) error
+}
+
+// CapturedFrame is a frame read from a capture.
+type CapturedFrame struct {
+	RTUFrame
+	Direction Direction
+}
+
+// CaptureWriter writes frames in the capture format. It is safe for
+// concurrent use.
+type CaptureWriter struct {
+	mu          sync.Mutex
+	w           io.Writer
+	wroteHeader bool
+}
+
+// NewCaptureWriter returns a CaptureWriter writing to w.
+func NewCaptureWriter(w io.Writer) *CaptureWriter {
+	return &CaptureWriter{w: w}
+}
+
+// WriteFrame implements FrameWriter.
+func (c *CaptureWriter) WriteFrame(t time.Time, dir Direction, adu []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.wroteHeader {
+		if _, err := fmt.Fprintln(c.w, captureHeader); err != nil {
+			return err
+		}
+		c.wroteHeader = true
+	}
+	_, err := fmt.Fprintf(c.w, "%s %v %s\n", t.UTC().Format(time.RFC3339Nano), dir, hex.EncodeToString(adu))
+	return err
+}
+
+// CaptureReader reads frames in the capture format.
+type CaptureReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+// NewCaptureReader returns a CaptureReader reading from r.
+func NewCaptureReader(r io.Reader) *CaptureReader {
+	return &CaptureReader{s: bufio.NewScanner(r)}
+}
+
+// ReadFrame returns the next frame, or io.EOF at the end of the capture.
+func (c *CaptureReader) ReadFrame() (*CapturedFrame, error) {
+	for c.s.Scan() {
+		c.line++
+		text := strings.TrimSpace(c.s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		frame, err := parseCaptureLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("capture line %d: %w", c.line, err)
+		}
+		return frame, nil
+	}
+	if err := c.s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// ReadAll returns the remaining frames.
+func (c *CaptureReader) ReadAll() ([]*CapturedFrame, error) {
+	var frames []*CapturedFrame
+	for {
+		frame, err := c.ReadFrame()
+		if err == io.EOF {
+			return frames, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+	}
+}
+
+func parseCaptureLine(text string) (*CapturedFrame, error) {
+	fields := strings.Fields(text)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("got %d fields, want 3", len(fields))
+	}
+	t, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return nil, err
+	}
+	dir, err := parseDirection(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	adu, err := hex.DecodeString(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	return &CapturedFrame{RTUFrame{t, adu}, dir}, nil
+}
+
+// captureHandler records the frames exchanged by a handler.
+type captureHandler struct {
+	connHandler
+	w FrameWriter
+	// toRTU converts a frame of the handler to an RTU frame, if needed.
+	toRTU func(adu []byte) []byte
+}
+
+// Send implements modbus.Transporter.
+func (h *captureHandler) Send(aduRequest []byte) ([]byte, error) {
+	h.record(DirectionRequest, aduRequest)
+	aduResponse, err := h.connHandler.Send(aduRequest)
+	if len(aduResponse) > 0 {
+		h.record(DirectionResponse, aduResponse)
+	}
+	return aduResponse, err
+}
+
+func (h *captureHandler) record(dir Direction, adu []byte) {
+	if h.toRTU != nil {
+		adu = h.toRTU(adu)
+	}
+	if err := h.w.WriteFrame(time.Now(), dir, adu); err != nil {
+		glog.Warningf("error writing capture: %v", err)
+	}
+}
+
+// tcpToRTU converts a Modbus TCP frame to the equivalent RTU frame.
+func tcpToRTU(adu []byte) []byte {
+	// MBAP header: transaction id (2), protocol id (2), length (2), unit id (1).
+	if len(adu) < 8 {
+		return adu
+	}
+	frame := append([]byte{adu[6]}, adu[7:]...)
+	crc := rtuChecksum(frame)
+	return append(frame, byte(crc), byte(crc>>8))
+}
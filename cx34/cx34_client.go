@@ -2,22 +2,24 @@
 package cx34
 
 import (
-	"encoding/hex"
+	"context"
 	"fmt"
 	"io"
 	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/goburrow/modbus"
 	"github.com/goburrow/serial"
 	"github.com/golang/glog"
-	"github.com/howeyc/crc16"
-	"go.uber.org/multierr"
 
 	"github.com/sodabrew/chilctl/units"
 )
 
-// Parameters from https://www.chiltrix.com/control-options/Remote-Gateway-BACnet-Guide-rev2.pdf
+// Default serial parameters from https://www.chiltrix.com/control-options/Remote-Gateway-BACnet-Guide-rev2.pdf
 const (
 	baudRate = 9600
 	parity   = "N"
@@ -32,16 +34,37 @@ const (
 	registersPerRead              = 120
 )
 
+// Default port for Modbus TCP gateways.
+const defaultTCPPort = "502"
+
+// Default time to wait for the response to a request.
+const defaultTimeout = 10 * time.Second
+
+// Network selects how Modbus frames are carried to a network Address.
+type Network string
+
+// Valid networks.
+const (
+	// ModbusTCP speaks Modbus TCP (MBAP framing) to a Modbus gateway.
+	ModbusTCP Network = "tcp"
+
+	// RTUOverTCP sends raw Modbus RTU frames, CRC included, over a plain TCP
+	// stream. This is what ser2net and most serial device servers forward.
+	RTUOverTCP Network = "rtu-over-tcp"
+)
+
 // Mode indicates the protocol that should be used to communicate with the CX34.
 type Mode string
 
 // Valid modes.
 const (
-	// Modbus mode uses modbus to communicate with the CX34. This is a
-	// standardized protocol, but so far the library doesn't support it.
+	// Modbus mode uses Modbus to communicate with the CX34, over a serial
+	// port or, with Params.Address, a Modbus TCP or RTU-over-TCP gateway.
 	Modbus Mode = "modbus"
 
 	// CX34Text uses a proprietary protocol from Omron to communicate with the CX34.
+	// The client only listens to this traffic: ReadState returns the
+	// registers seen so far, and writes fail with ErrReadOnly.
 	CX34Text Mode = "cx34text"
 )
 
@@ -49,128 +72,455 @@ const (
 type Params struct {
 	// The /dev/ttyX device shown by dmesg for the RS-485 connection to the heat pump.
 	TTYDevice string
+	// Serial parameters of TTYDevice. These must match the communication
+	// settings of the controller; zero values select the factory defaults of
+	// 9600 baud, 8 data bits, no parity ("N") and 1 stop bit. See AutoDetect.
+	BaudRate int
+	DataBits int
+	Parity   string
+	StopBits int
+	// RS485 configures kernel RS-485 mode on TTYDevice.
+	RS485 RS485Config
+	// Network address of a gateway in front of the heat pump, such as
+	// "tcp://10.0.0.5:502". When set, TTYDevice is ignored.
+	Address string
+	// Network selects the framing used on Address. If empty, it is taken
+	// from the scheme of Address, defaulting to ModbusTCP.
+	Network   Network
 	LogWriter io.Writer
 	Mode      Mode
 	UnitId    int
+
+	// MinReconnectDelay is how long to wait before reopening a lost
+	// connection. The delay doubles after each failed attempt, up to
+	// MaxReconnectDelay. Zero values select one second and one minute.
+	MinReconnectDelay time.Duration
+	MaxReconnectDelay time.Duration
+
+	// Timeout bounds the wait for the response to a single Modbus request.
+	// Zero selects 10 seconds.
+	Timeout time.Duration
+
+	// Retry controls how failed requests are retried.
+	Retry RetryPolicy
+
+	// MaxRegistersPerRead limits the size of each ReadHoldingRegisters
+	// request. Zero selects 120; Modbus allows at most 125.
+	MaxRegistersPerRead int
+	// MaxReadGap is the largest number of unrequested registers that may be
+	// read, and discarded, to join two requested ranges into one request.
+	// Zero selects 16; a negative value never joins ranges.
+	MaxReadGap int
+
+	// VerifyWrites reads every written register back. If the value differs,
+	// the write is repeated up to Retry.Attempts times before failing with a
+	// *WriteMismatchError, which matches ErrVerify, after which ApplySettings
+	// restores the prior values.
+	VerifyWrites bool
+
+	// Capture, if set, records every frame exchanged with the heat pump,
+	// for example with a CaptureWriter for later replay.
+	Capture FrameWriter
+}
+
+// RS485Config configures the kernel RS-485 mode of a serial device, for
+// adapters that rely on the driver to drive the transmitter enable line from
+// RTS, such as a Raspberry Pi UART wired to a MAX485. USB adapters with
+// automatic direction control, like the FT232 based ones, do not need it.
+//
+// The configuration is ignored unless Enabled is set. Delays are applied with
+// millisecond resolution.
+type RS485Config struct {
+	Enabled bool
+	// RTSOnSend drives RTS high while sending; otherwise it is driven low.
+	RTSOnSend bool
+	// RTSAfterSend drives RTS high after sending; otherwise it is driven low.
+	RTSAfterSend bool
+	// DelayBeforeSend is the delay between asserting RTS and sending.
+	DelayBeforeSend time.Duration
+	// DelayAfterSend is the delay between the end of sending and releasing RTS.
+	DelayAfterSend time.Duration
+	// RxDuringTx keeps the receiver enabled while sending, which echoes sent
+	// bytes back on adapters that do not suppress them.
+	RxDuringTx bool
+}
+
+func (c RS485Config) serialConfig() serial.RS485Config {
+	return serial.RS485Config{
+		Enabled:            c.Enabled,
+		DelayRtsBeforeSend: c.DelayBeforeSend,
+		DelayRtsAfterSend:  c.DelayAfterSend,
+		RtsHighDuringSend:  c.RTSOnSend,
+		RtsHighAfterSend:   c.RTSAfterSend,
+		RxDuringTx:         c.RxDuringTx,
+	}
+}
+
+// timeout returns the per-attempt timeout configured by p.
+func (p *Params) timeout() time.Duration {
+	if p.Retry.AttemptTimeout > 0 {
+		return p.Retry.AttemptTimeout
+	}
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return defaultTimeout
+}
+
+// RetryPolicy controls how a failed request is retried. Timeouts, CRC
+// mismatches, busy responses and connection failures are retried; Modbus
+// exceptions such as ErrIllegalAddress are not, since resending the same
+// request cannot help.
+type RetryPolicy struct {
+	// Attempts is the number of times a request is tried, including the
+	// first. Zero means 1, that is, no retries.
+	Attempts int
+	// AttemptTimeout bounds each attempt. Zero uses Params.Timeout.
+	AttemptTimeout time.Duration
+	// Backoff is the delay before the first retry. It doubles for each
+	// retry after that.
+	Backoff time.Duration
+}
+
+func (r RetryPolicy) attempts() int {
+	if r.Attempts < 1 {
+		return 1
+	}
+	return r.Attempts
+}
+
+// Transport carries Modbus requests to the heat pump. A modbus.Client
+// satisfies it; other implementations can fake, record or cache traffic.
+//
+// Results are the raw response data as returned by modbus.Client: two
+// big-endian bytes per register for reads.
+type Transport interface {
+	// ReadHoldingRegisters reads quantity contiguous holding registers
+	// starting at address.
+	ReadHoldingRegisters(address, quantity uint16) (results []byte, err error)
+	// WriteSingleRegister writes value to the holding register at address.
+	WriteSingleRegister(address, value uint16) (results []byte, err error)
+	// WriteMultipleRegisters writes quantity contiguous holding registers
+	// starting at address from the big-endian bytes in value.
+	WriteMultipleRegisters(address, quantity uint16, value []byte) (results []byte, err error)
 }
 
 // Client is used to communicate with the Chiltrix CX34 heat pump.
+//
+// A Client is safe for concurrent use. Requests are sent one at a time, and
+// writes waiting for the bus go ahead of waiting reads, so a setting change
+// is not held up by a ReadState sweep running in another goroutine.
 type Client struct {
-	c modbus.Client
+	c          Transport
+	retry      RetryPolicy
+	sched      *scheduler
+	maxPerRead int
+	maxReadGap int
+	verify     bool
+
+	// For clients that only listen, the source of register values and how
+	// long ReadState waits for the named registers it asks for to be seen
+	// on the bus.
+	monitor        *Monitor
+	passiveTimeout time.Duration
+}
+
+// NewClient returns a client that talks to the heat pump through t. Unlike
+// Connect, it does not check that the heat pump responds.
+//
+// Only the fields of p that do not concern the connection itself, such as
+// Retry, are used. p may be nil.
+func NewClient(t Transport, p *Params) *Client {
+	c := &Client{
+		c:          t,
+		sched:      newScheduler(),
+		maxPerRead: registersPerRead,
+		maxReadGap: defaultMaxReadGap,
+	}
+	if p != nil {
+		c.retry = p.Retry
+		c.verify = p.VerifyWrites
+		if p.MaxRegistersPerRead > 0 {
+			c.maxPerRead = p.MaxRegistersPerRead
+		}
+		if p.MaxReadGap != 0 {
+			c.maxReadGap = p.MaxReadGap
+		}
+	}
+	return c
 }
 
 // Connect connects a new client to the heat pump or returns an error.
+//
+// The connection is kept open until Close is called. If it is lost, for
+// example because a USB adapter was unplugged, it is reopened by a later
+// request; see Params.MinReconnectDelay.
 func Connect(p *Params) (*Client, error) {
 	if p.Mode != Modbus && p.Mode != CX34Text {
 		return nil, fmt.Errorf("Invalid mode %q", p.Mode)
 	}
+	if p.Mode == CX34Text {
+		if p.Address != "" {
+			return nil, fmt.Errorf("mode %q requires a serial device, not a network address", p.Mode)
+		}
+		return connectText(p)
+	}
+
+	handler, err := newHandler(p)
+	if err != nil {
+		return nil, err
+	}
+	conn := newConn(handler, p)
+	if err := conn.connect(); err != nil {
+		return nil, fmt.Errorf("Connect failed: %w", err)
+	}
+	c := NewClient(conn, p)
+	if err := c.CheckConnection(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the connection to the heat pump. The client must not be used
+// afterwards. If the transport passed to NewClient implements io.Closer, it is
+// closed.
+func (c *Client) Close() error {
+	if closer, ok := c.c.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// newHandler returns a handler for the serial device or network address in p.
+func newHandler(p *Params) (connHandler, error) {
+	var handler connHandler = &rtuSerialHandler{newSerialHandler(p)}
+	if p.Address != "" {
+		var err error
+		if handler, err = newNetworkHandler(p); err != nil {
+			return nil, err
+		}
+	}
+	if p.Capture == nil {
+		return handler, nil
+	}
+	h := &captureHandler{connHandler: handler, w: p.Capture}
+	if _, ok := handler.(*modbus.TCPClientHandler); ok {
+		h.toRTU = tcpToRTU
+	}
+	return h, nil
+}
+
+// newSerialHandler returns a Modbus RTU handler for p.TTYDevice.
+func newSerialHandler(p *Params) *modbus.RTUClientHandler {
 	// Modbus RTU/ASCII
 	handler := modbus.NewRTUClientHandler(p.TTYDevice)
 	handler.BaudRate = baudRate
 	handler.DataBits = dataBits
 	handler.Parity = parity
 	handler.StopBits = stopBits
+	if p.BaudRate != 0 {
+		handler.BaudRate = p.BaudRate
+	}
+	if p.DataBits != 0 {
+		handler.DataBits = p.DataBits
+	}
+	if p.Parity != "" {
+		handler.Parity = p.Parity
+	}
+	if p.StopBits != 0 {
+		handler.StopBits = p.StopBits
+	}
 	handler.SlaveId = uint8(p.UnitId)
-	handler.Timeout = 10 * time.Second
-	handler.RS485 = serial.RS485Config{
-		Enabled:            false,
-		DelayRtsAfterSend:  0,
-		DelayRtsBeforeSend: 0,
-		RtsHighAfterSend:   false,
-		RtsHighDuringSend:  false,
-		RxDuringTx:         true,
+	handler.Timeout = p.timeout()
+	handler.IdleTimeout = 0
+	handler.RS485 = p.RS485.serialConfig()
+	return handler
+}
+
+// connHandler is a modbus.ClientHandler with an explicit connection lifecycle.
+type connHandler interface {
+	modbus.ClientHandler
+	Connect() error
+	Close() error
+}
+
+// newNetworkHandler returns a handler for the gateway named by p.Address.
+func newNetworkHandler(p *Params) (connHandler, error) {
+	network, host, err := parseAddress(p.Address)
+	if err != nil {
+		return nil, err
+	}
+	if p.Network != "" {
+		network = p.Network
 	}
+	switch network {
+	case ModbusTCP:
+		handler := modbus.NewTCPClientHandler(host)
+		handler.SlaveId = uint8(p.UnitId)
+		handler.Timeout = p.timeout()
+		handler.IdleTimeout = 0
+		return handler, nil
+	case RTUOverTCP:
+		handler := newRTUOverTCPHandler(host)
+		handler.SlaveId = uint8(p.UnitId)
+		handler.Timeout = p.timeout()
+		return handler, nil
+	}
+	return nil, fmt.Errorf("unsupported network %q", network)
+}
 
-	if p.Mode == CX34Text {
-		port, err := serial.Open(&handler.Config)
+// parseAddress splits an address such as "tcp://10.0.0.5:502" into its
+// network and host:port. A bare host:port is taken to be ModbusTCP.
+func parseAddress(address string) (Network, string, error) {
+	network := ModbusTCP
+	if strings.Contains(address, "://") {
+		u, err := url.Parse(address)
 		if err != nil {
-			return nil, fmt.Errorf("serial.Open failure: %w", err)
+			return "", "", fmt.Errorf("invalid address %q: %w", address, err)
 		}
-		_, err = io.Copy(p.LogWriter, port)
-		if err != nil {
-			return nil, fmt.Errorf("io.Copy failure: %w", err)
-		}
-		return nil, nil
+		network, address = Network(u.Scheme), u.Host
 	}
-
-	err := handler.Connect()
-	defer handler.Close()
+	host, port, err := net.SplitHostPort(address)
 	if err != nil {
-		return nil, fmt.Errorf("Connect failed: %w", err)
+		// No port given. An IPv6 address may still be in brackets.
+		host, port = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"), defaultTCPPort
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("invalid address %q: missing host", address)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", "", fmt.Errorf("invalid address %q: bad port %q", address, port)
 	}
+	return network, net.JoinHostPort(host, port), nil
+}
 
-	client := modbus.NewClient(handler)
-	c := &Client{c: client}
+// ReadState returns a snapshot of the state of the heat pump.
+//
+// By default all holding registers are read. Pass WithGroups or WithRanges to
+// read only some of them; the returned State then holds only those registers.
+func (c *Client) ReadState(opts ...ReadOption) (*State, error) {
+	return c.ReadStateContext(context.Background(), opts...)
+}
 
-	if err := c.CheckConnection(); err != nil {
-		return nil, err
+// ReadStateContext is like ReadState but gives up when ctx is done.
+func (c *Client) ReadStateContext(ctx context.Context, opts ...ReadOption) (*State, error) {
+	o := &readOptions{}
+	for _, opt := range opts {
+		opt(o)
 	}
-	return c, nil
+	if len(o.ranges) == 0 {
+		if c.monitor != nil {
+			// A listener sees only the registers the bus master asks for.
+			return c.monitor.read(ctx, nil, c.passiveTimeout)
+		}
+		o.ranges = AllRegisters.Ranges
+	}
+	return c.ReadRegistersContext(ctx, o.ranges...)
 }
 
-// ReadState returns a snapshot of the state of the heat pump.
-func (c *Client) ReadState() (*State, error) {
+// ReadRegisters returns a snapshot holding only the given registers, using as
+// few requests as possible.
+func (c *Client) ReadRegisters(ranges ...RegisterRange) (*State, error) {
+	return c.ReadRegistersContext(context.Background(), ranges...)
+}
+
+// ReadRegistersContext is like ReadRegisters but gives up when ctx is done.
+func (c *Client) ReadRegistersContext(ctx context.Context, ranges ...RegisterRange) (*State, error) {
+	if c.monitor != nil {
+		return c.monitor.read(ctx, ranges, c.passiveTimeout)
+	}
+	plan, err := planReads(ranges, c.maxPerRead, c.maxReadGap)
+	if err != nil {
+		return nil, err
+	}
+	requested, _ := mergeRanges(ranges)
 	// ReadCoils, ReadInputRegisters, and ReadDiscreteInputs are not supported.
 	// However, ReadHoldingRegisters is.
 	m := make(map[Register]uint16)
-	for i := firstHoldingRegister; i <= lastHoldingRegister; i += registersPerRead {
-		count := registersPerRead
-		if i+Register(count) > lastHoldingRegister {
-			count = int(lastHoldingRegister) - int(i+1)
-		}
-		results, err := c.c.ReadHoldingRegisters(uint16(i), uint16(count))
+	for _, r := range plan {
+		count := r.Len()
+		results, err := c.call(ctx, readPriority, func() ([]byte, error) {
+			return c.c.ReadHoldingRegisters(r.First.uint16(), uint16(count))
+		})
 		if err != nil {
-			return nil, fmt.Errorf("ReadHoldingRegisters() failed: %w", err)
+			return nil, fmt.Errorf("ReadHoldingRegisters(%v) failed: %w", r, err)
 		}
 		if len(results)%2 != 0 {
 			return nil, fmt.Errorf("got register data of length %d, want modulus of 2", len(results))
 		}
-		if len(results)/2 > count {
-			return nil, fmt.Errorf("returned register data of length %d exceeds expected length %d", len(results)/2, count)
+		if len(results)/2 != count {
+			return nil, fmt.Errorf("returned register data of length %d does not match expected length %d", len(results)/2, count)
 		}
-		for j := 0; j < len(results)/2; j++ {
-			value := uint16(results[j*2])<<8 + uint16(results[j*2+1])
-			m[Register(j)+i] = value
+		for j := 0; j < count; j++ {
+			reg := r.First + Register(j)
+			if !inRanges(requested, reg) {
+				// Read only to fill a gap between requested ranges.
+				continue
+			}
+			m[reg] = uint16(results[j*2])<<8 + uint16(results[j*2+1])
 		}
 	}
 	return &State{time.Now(), m}, nil
 }
 
 func (c *Client) SetOnOffMode(onoff bool) error {
+	return c.SetOnOffModeContext(context.Background(), onoff)
+}
+
+// SetOnOffModeContext is like SetOnOffMode but gives up when ctx is done.
+func (c *Client) SetOnOffModeContext(ctx context.Context, onoff bool) error {
 	onoffint := 0
 	if onoff {
 		onoffint = 1
 	}
-	res, err := c.c.WriteSingleRegister(OnOffMode.uint16(), uint16(onoffint))
-	if err != nil {
-		return fmt.Errorf("WriteSingleRegister error: %w (returned bytes %v)", err, res)
-	}
-	return nil
+	return c.writeRegister(ctx, OnOffMode, uint16(onoffint))
 }
 
 func (c *Client) SetACMode(m AirConditioningMode) error {
-	if m < 0 || m > 4 {
-		return fmt.Errorf("mode is out of range 0-4: %v", m)
-	}
-	registerValue := uint16(m)
-	res, err := c.c.WriteSingleRegister(ACMode.uint16(), registerValue)
+	return c.SetACModeContext(context.Background(), m)
+}
+
+// SetACModeContext is like SetACMode but gives up when ctx is done.
+func (c *Client) SetACModeContext(ctx context.Context, m AirConditioningMode) error {
+	registerValue, err := acModeValue(m)
 	if err != nil {
-		return fmt.Errorf("WriteSingleRegister error: %w (returned bytes %v)", err, res)
+		return err
 	}
-	return nil
+	return c.writeRegister(ctx, ACMode, registerValue)
 }
 
-// SetHeatingTemp sets the target heating temperature for the CX34.
-func (c *Client) SetHeatingTemp(t units.Temperature) error {
+// targetTempValue returns the register value for a target temperature.
+func targetTempValue(t units.Temperature) (uint16, error) {
 	deg := t.Celsius()
 	if deg < 5 || deg > 70 {
-		return fmt.Errorf("temperature is out of range: %v", t)
+		return 0, fmt.Errorf("temperature is out of range: %v", t)
+	}
+	return uint16(math.Round(t.Celsius())), nil
+}
+
+// acModeValue returns the register value for an operating mode.
+func acModeValue(m AirConditioningMode) (uint16, error) {
+	if m < 0 || m > 4 {
+		return 0, fmt.Errorf("mode is out of range 0-4: %v", m)
 	}
-	registerValue := uint16(math.Round(t.Celsius()))
+	return uint16(m), nil
+}
+
+// SetHeatingTemp sets the target heating temperature for the CX34.
+func (c *Client) SetHeatingTemp(t units.Temperature) error {
+	return c.SetHeatingTempContext(context.Background(), t)
+}
 
-	res, err := c.c.WriteSingleRegister(TargetACHeatingModeTemp.uint16(), registerValue)
+// SetHeatingTempContext is like SetHeatingTemp but gives up when ctx is done.
+func (c *Client) SetHeatingTempContext(ctx context.Context, t units.Temperature) error {
+	registerValue, err := targetTempValue(t)
 	if err != nil {
-		return fmt.Errorf("WriteSingleRegister error: %w (returned bytes %v)", err, res)
+		return err
+	}
+
+	if err := c.writeRegister(ctx, TargetACHeatingModeTemp, registerValue); err != nil {
+		return err
 	}
 	glog.Infof("set target heating temperature to %.2f°C/%.2f°F", t.Celsius(), t.Fahrenheit())
 	return nil
@@ -178,15 +528,18 @@ func (c *Client) SetHeatingTemp(t units.Temperature) error {
 
 // SetCoolingTemp sets the target heating temperature for the CX34.
 func (c *Client) SetCoolingTemp(t units.Temperature) error {
-	deg := t.Celsius()
-	if deg < 5 || deg > 70 {
-		return fmt.Errorf("temperature is out of range: %v", t)
-	}
-	registerValue := uint16(math.Round(t.Celsius()))
+	return c.SetCoolingTempContext(context.Background(), t)
+}
 
-	res, err := c.c.WriteSingleRegister(TargetACCoolingModeTemp.uint16(), registerValue)
+// SetCoolingTempContext is like SetCoolingTemp but gives up when ctx is done.
+func (c *Client) SetCoolingTempContext(ctx context.Context, t units.Temperature) error {
+	registerValue, err := targetTempValue(t)
 	if err != nil {
-		return fmt.Errorf("WriteSingleRegister error: %w (returned bytes %v)", err, res)
+		return err
+	}
+
+	if err := c.writeRegister(ctx, TargetACCoolingModeTemp, registerValue); err != nil {
+		return err
 	}
 	glog.Infof("set target cooling temperature to %.2f°C/%.2f°F", t.Celsius(), t.Fahrenheit())
 	return nil
@@ -194,47 +547,169 @@ func (c *Client) SetCoolingTemp(t units.Temperature) error {
 
 // SetHeatingTemp sets the target heating temperature for the CX34.
 func (c *Client) SetDomesticHotWaterTemp(t units.Temperature) error {
-	deg := t.Celsius()
-	if deg < 5 || deg > 70 {
-		return fmt.Errorf("temperature is out of range: %v", t)
-	}
-	registerValue := uint16(math.Round(t.Celsius()))
+	return c.SetDomesticHotWaterTempContext(context.Background(), t)
+}
 
-	res, err := c.c.WriteSingleRegister(TargetDomesticHotWaterTemp.uint16(), registerValue)
+// SetDomesticHotWaterTempContext is like SetDomesticHotWaterTemp but gives up
+// when ctx is done.
+func (c *Client) SetDomesticHotWaterTempContext(ctx context.Context, t units.Temperature) error {
+	registerValue, err := targetTempValue(t)
 	if err != nil {
-		return fmt.Errorf("WriteSingleRegister error: %w (returned bytes %v)", err, res)
+		return err
+	}
+
+	if err := c.writeRegister(ctx, TargetDomesticHotWaterTemp, registerValue); err != nil {
+		return err
 	}
 	glog.Infof("set target DHW temperature to %.2f°C/%.2f°F", t.Celsius(), t.Fahrenheit())
 	return nil
 }
 
-func (c *Client) setRegisterValue(reg, value uint16) error {
-	res, err := c.c.WriteSingleRegister(reg, value)
+// writeRegister writes a single holding register and, if the client verifies
+// writes, checks that it reads back the same value.
+func (c *Client) writeRegister(ctx context.Context, reg Register, value uint16) error {
+	attempts := 1
+	if c.verify {
+		attempts = c.retry.attempts()
+	}
+	for attempt := 1; ; attempt++ {
+		if err := c.writeSingle(ctx, reg, value); err != nil {
+			return err
+		}
+		if !c.verify {
+			return nil
+		}
+		got, err := c.readRegister(ctx, writePriority, reg)
+		if err != nil {
+			return fmt.Errorf("error reading back register %v: %w", reg, err)
+		}
+		if got == value {
+			return nil
+		}
+		mismatch := &WriteMismatchError{Register: reg, Wrote: value, ReadBack: got}
+		if attempt >= attempts {
+			return mismatch
+		}
+		glog.Warningf("%v (attempt %d of %d), writing again", mismatch, attempt, attempts)
+	}
+}
+
+// writeSingle writes a single holding register without verification.
+func (c *Client) writeSingle(ctx context.Context, reg Register, value uint16) error {
+	res, err := c.call(ctx, writePriority, func() ([]byte, error) {
+		return c.c.WriteSingleRegister(reg.uint16(), value)
+	})
 	if err != nil {
 		return fmt.Errorf("WriteSingleRegister error: %w (returned bytes %v)", err, res)
 	}
-	glog.Infof("set register value %d to %d; got response %v", reg, value, res)
 	return nil
 }
 
-// CheckConnection attempts to connect to the heat pump and returns an error if the connection fails.
-func (c *Client) CheckConnection() error {
-	_, err := c.ReadState()
-	return err
-	var finalErr error
-	if _, err := c.c.ReadCoils(1, 1); err != nil {
-		finalErr = multierr.Append(finalErr, fmt.Errorf("ReadCoils error: %w", err))
+// readRegister reads a single holding register.
+func (c *Client) readRegister(ctx context.Context, p priority, reg Register) (uint16, error) {
+	results, err := c.call(ctx, p, func() ([]byte, error) {
+		return c.c.ReadHoldingRegisters(reg.uint16(), 1)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(results) != 2 {
+		return 0, fmt.Errorf("got register data of length %d, want 2", len(results))
+	}
+	return uint16(results[0])<<8 + uint16(results[1]), nil
+}
+
+// call runs a single request on the transport, retrying according to the
+// client's RetryPolicy. Errors are classified; see ErrTimeout.
+func (c *Client) call(ctx context.Context, p priority, op func() ([]byte, error)) ([]byte, error) {
+	attempts := c.retry.attempts()
+	delay := c.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		results, err := c.attempt(ctx, p, op)
+		if err == nil || attempt >= attempts || !isRetryable(err) {
+			return results, err
+		}
+		glog.Warningf("modbus request failed (attempt %d of %d), retrying in %v: %v", attempt, attempts, delay, err)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+		delay *= 2
+	}
+}
+
+// attempt waits for the bus and runs op once, giving up when ctx is done or
+// the attempt times out.
+//
+// A request that is already on the wire cannot be interrupted. If ctx ends
+// first, the request finishes in the background, still holding the bus, and
+// its result is dropped; the transport's own timeout (Params.Timeout) bounds
+// how long that takes.
+func (c *Client) attempt(ctx context.Context, p priority, op func() ([]byte, error)) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := c.sched.acquire(ctx, p); err != nil {
+		return nil, err
+	}
+	attemptCtx := ctx
+	if c.retry.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, c.retry.AttemptTimeout)
+		defer cancel()
+	}
+	type result struct {
+		b   []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer c.sched.release()
+		b, err := op()
+		done <- result{b, err}
+	}()
+	select {
+	case r := <-done:
+		return r.b, classifyError(r.err)
+	case <-attemptCtx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &classifiedError{ErrTimeout, fmt.Errorf("no response within %v", c.retry.AttemptTimeout)}
 	}
-	if _, err := c.c.ReadInputRegisters(1, 1); err != nil {
-		finalErr = multierr.Append(finalErr, fmt.Errorf("ReadInputRegisters error: %w", err))
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
 	}
-	if _, err := c.c.ReadFIFOQueue(1); err != nil {
-		finalErr = multierr.Append(finalErr, fmt.Errorf("ReadFIFOQueue error: %w", err))
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	if _, err := c.c.ReadDiscreteInputs(1, 1); err != nil {
-		finalErr = multierr.Append(finalErr, fmt.Errorf("ReadDiscreteInputs error: %w", err))
+}
+
+func (c *Client) setRegisterValue(reg, value uint16) error {
+	if err := c.writeRegister(context.Background(), Register(reg), value); err != nil {
+		return err
 	}
-	return finalErr
+	glog.Infof("set register value %d to %d", reg, value)
+	return nil
+}
+
+// CheckConnection attempts to connect to the heat pump and returns an error if the connection fails.
+func (c *Client) CheckConnection() error {
+	return c.CheckConnectionContext(context.Background())
+}
+
+// CheckConnectionContext is like CheckConnection but gives up when ctx is done.
+func (c *Client) CheckConnectionContext(ctx context.Context) error {
+	_, err := c.ReadStateContext(ctx, WithGroups(Setpoints))
+	return err
 }
 
 // State is a snapshot of the heat pump's state.
@@ -243,6 +718,17 @@ type State struct {
 	registerValues map[Register]uint16
 }
 
+// NewState returns a State holding the register values read at
+// collectionTime, for tests and tools that do not read them from a heat
+// pump. The values are copied.
+func NewState(collectionTime time.Time, values map[Register]uint16) *State {
+	m := make(map[Register]uint16, len(values))
+	for reg, v := range values {
+		m[reg] = v
+	}
+	return &State{collectionTime, m}
+}
+
 // CollectionTime returns the collection time of the heat pump state log entry.
 func (s *State) CollectionTime() time.Time {
 	return s.collectionTime
@@ -262,33 +748,40 @@ func (r Register) uint16() uint16 {
 
 // String returns a human-readable name of the modbus register.
 func (r Register) String() string {
-	if name, ok := registerNames[r]; ok {
-		return name
+	if info, ok := registerInfo[r]; ok {
+		return info.Name
 	}
 	return fmt.Sprintf("%d", r)
 }
 
+// Logger copies the bytes of a serial line to raw, and records each Modbus
+// RTU frame found in them to debug in the capture format. Frames are split
+// on the silence between them, as on a 9600 baud line, and each request and
+// response pair is decoded to the info log.
 type Logger struct {
-	debug, raw io.Writer
+	frames  FrameWriter
+	raw     io.Writer
+	framer  *RTUFramer
+	tracker rtuTracker
 }
 
 func NewLogger(debug, raw io.Writer) *Logger {
-	return &Logger{debug, raw}
+	return NewFrameLogger(NewCaptureWriter(debug), raw)
+}
+
+// NewFrameLogger returns a Logger that records frames to w, for example a
+// PcapWriter, instead of a capture. raw may be nil.
+func NewFrameLogger(w FrameWriter, raw io.Writer) *Logger {
+	return &Logger{frames: w, raw: raw, framer: NewRTUFramer(0)}
 }
 
 func (l *Logger) Write(p []byte) (n int, err error) {
-	t := time.Now()
-	{
-		pdu, err := decodeFrame(p)
-		msg := fmt.Sprintf("error decoding frame: %v", err)
-		if err == nil {
-			msg = fmt.Sprintf("decoded frame with code %v", pdu.FunctionCode)
-		}
-		glog.Infof("got %q: %s", string(p), msg)
-	}
-	if _, err := fmt.Fprintf(l.debug, "%d %q // %d bytes; %s\n", t.UnixNano(), hex.EncodeToString(p), len(p), t); err != nil {
+	if err := l.logFrames(l.framer.Feed(time.Now(), p)); err != nil {
 		return 0, err
 	}
+	if l.raw == nil {
+		return len(p), nil
+	}
 	if l, err := l.raw.Write(p); err != nil {
 		return 0, fmt.Errorf("raw output error: %w", err)
 	} else if l != len(p) {
@@ -297,16 +790,35 @@ func (l *Logger) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
+// Flush logs the frame still buffered, if any. Call it when the line has
+// been idle, or at the end of the stream.
+func (l *Logger) Flush() error {
+	return l.logFrames(l.framer.Flush())
+}
+
+func (l *Logger) logFrames(frames []RTUFrame) error {
+	for _, f := range frames {
+		tx, dir := l.tracker.observe(f.ADU)
+		if tx != nil {
+			glog.Info(tx)
+		}
+		if err := l.frames.WriteFrame(f.Time, dir, f.ADU); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func decodeFrame(adu []byte) (*modbus.ProtocolDataUnit, error) {
 	if len(adu) < 4 {
 		return nil, fmt.Errorf("modbus: argument cannot possibly be a legitimate Application Data Unit: size is too small (%d bytes)", len(adu))
 	}
 	length := len(adu)
 	// Calculate checksum
-	crcCalculated := ^crc16.ChecksumIBM(adu[0 : length-2]) //crc16.Update(65535, crc16.IBMTable, adu[0:length-2])
+	crcCalculated := rtuChecksum(adu[0 : length-2])
 	crcPacket := uint16(adu[length-1])<<8 | uint16(adu[length-2])
 	if crcPacket != crcCalculated {
-		return nil, fmt.Errorf("modbus: response crc %d does not match expected %d in %d-byte package", crcCalculated, crcPacket, length)
+		return nil, &classifiedError{ErrCRCMismatch, fmt.Errorf("modbus: response crc %d does not match expected %d in %d-byte package", crcCalculated, crcPacket, length)}
 	}
 	// Function code & data
 	return &modbus.ProtocolDataUnit{
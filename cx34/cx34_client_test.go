@@ -0,0 +1,56 @@
+package cx34
+
+import "testing"
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		network Network
+		host    string
+	}{
+		{"10.0.0.5:502", ModbusTCP, "10.0.0.5:502"},
+		{"10.0.0.5", ModbusTCP, "10.0.0.5:502"},
+		{"heatpump.local:5020", ModbusTCP, "heatpump.local:5020"},
+		{"tcp://10.0.0.5:5020", ModbusTCP, "10.0.0.5:5020"},
+		{"tcp://10.0.0.5", ModbusTCP, "10.0.0.5:502"},
+		{"rtu-over-tcp://10.0.0.6:4196", RTUOverTCP, "10.0.0.6:4196"},
+		{"rtu-over-tcp://gateway", RTUOverTCP, "gateway:502"},
+		{"[fe80::1]:5020", ModbusTCP, "[fe80::1]:5020"},
+		{"[fe80::1]", ModbusTCP, "[fe80::1]:502"},
+		{"tcp://[fe80::1]", ModbusTCP, "[fe80::1]:502"},
+		// Unknown networks are rejected when the handler is made.
+		{"udp://10.0.0.5:502", Network("udp"), "10.0.0.5:502"},
+	}
+	for _, tt := range tests {
+		network, host, err := parseAddress(tt.address)
+		if err != nil {
+			t.Errorf("parseAddress(%q) failed: %v", tt.address, err)
+			continue
+		}
+		if network != tt.network || host != tt.host {
+			t.Errorf("parseAddress(%q) = %q, %q, want %q, %q", tt.address, network, host, tt.network, tt.host)
+		}
+	}
+}
+
+func TestParseAddressErrors(t *testing.T) {
+	for _, address := range []string{
+		"",
+		":502",
+		"tcp://",
+		"tcp://:502",
+		"tcp://%zz",
+		"10.0.0.5:http",
+		"10.0.0.5:65536",
+	} {
+		if network, host, err := parseAddress(address); err == nil {
+			t.Errorf("parseAddress(%q) = %q, %q, want an error", address, network, host)
+		}
+	}
+}
+
+func TestNewNetworkHandlerRejectsUnknownNetwork(t *testing.T) {
+	if _, err := newNetworkHandler(&Params{Address: "udp://10.0.0.5:502"}); err == nil {
+		t.Errorf("newNetworkHandler accepted a udp:// address")
+	}
+}
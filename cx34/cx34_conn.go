@@ -0,0 +1,182 @@
+package cx34
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/golang/glog"
+)
+
+const (
+	defaultMinReconnectDelay = time.Second
+	defaultMaxReconnectDelay = time.Minute
+)
+
+// ErrClosed is returned for requests made after Client.Close.
+var ErrClosed = errors.New("cx34: connection is closed")
+
+// conn is a Transport over a long-lived handler connection.
+//
+// When a request fails with an I/O error, the connection is dropped and
+// reopened by the next request. A Modbus exception, a corrupted response or a
+// timeout concerns only the unit that was addressed, so it leaves the
+// connection, which other units on a Bus may be sharing, open. While reopening
+// keeps failing, requests fail fast until a backoff delay has passed; the
+// delay doubles with every failed attempt.
+type conn struct {
+	handler  connHandler
+	client   modbus.Client
+	unit     byte
+	minDelay time.Duration
+	maxDelay time.Duration
+	now      func() time.Time // for tests
+
+	mu          sync.Mutex
+	connected   bool
+	closed      bool
+	delay       time.Duration
+	nextAttempt time.Time
+	lastErr     error
+}
+
+func newConn(handler connHandler, p *Params) *conn {
+	c := &conn{
+		handler:  handler,
+		client:   modbus.NewClient(handler),
+		unit:     uint8(p.UnitId),
+		minDelay: p.MinReconnectDelay,
+		maxDelay: p.MaxReconnectDelay,
+		now:      time.Now,
+	}
+	if c.minDelay <= 0 {
+		c.minDelay = defaultMinReconnectDelay
+	}
+	if c.maxDelay <= 0 {
+		c.maxDelay = defaultMaxReconnectDelay
+	}
+	if c.maxDelay < c.minDelay {
+		c.maxDelay = c.minDelay
+	}
+	return c
+}
+
+// ReadHoldingRegisters implements Transport.
+func (c *conn) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	return c.do(c.unit, func() ([]byte, error) {
+		return c.client.ReadHoldingRegisters(address, quantity)
+	})
+}
+
+// WriteSingleRegister implements Transport.
+func (c *conn) WriteSingleRegister(address, value uint16) ([]byte, error) {
+	return c.do(c.unit, func() ([]byte, error) {
+		return c.client.WriteSingleRegister(address, value)
+	})
+}
+
+// WriteMultipleRegisters implements Transport.
+func (c *conn) WriteMultipleRegisters(address, quantity uint16, value []byte) ([]byte, error) {
+	return c.do(c.unit, func() ([]byte, error) {
+		return c.client.WriteMultipleRegisters(address, quantity, value)
+	})
+}
+
+// Close closes the underlying connection. Later requests fail with ErrClosed.
+func (c *conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.connected = false
+	return c.handler.Close()
+}
+
+// connect opens the connection right away, without any backoff.
+func (c *conn) connect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.handler.Connect(); err != nil {
+		return err
+	}
+	c.connected = true
+	return nil
+}
+
+// do runs op, which uses c.client, addressed to the given unit.
+func (c *conn) do(unit byte, op func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, ErrClosed
+	}
+	if err := c.reconnect(); err != nil {
+		return nil, err
+	}
+	setSlaveID(c.handler, unit)
+	results, err := op()
+	if err != nil && isConnectionError(err) {
+		glog.Warningf("dropping modbus connection after error: %v", err)
+		c.handler.Close()
+		c.connected = false
+	}
+	return results, err
+}
+
+// reconnect reopens a dropped connection unless the backoff delay from a
+// previous failure has not yet passed. Caller must hold the mutex.
+func (c *conn) reconnect() error {
+	if c.connected {
+		return nil
+	}
+	now := c.now()
+	if now.Before(c.nextAttempt) {
+		return fmt.Errorf("connection lost, next reconnect attempt in %v: %w", c.nextAttempt.Sub(now).Round(time.Millisecond), c.lastErr)
+	}
+	if err := c.handler.Connect(); err != nil {
+		if c.delay == 0 {
+			c.delay = c.minDelay
+		} else if c.delay *= 2; c.delay > c.maxDelay {
+			c.delay = c.maxDelay
+		}
+		c.lastErr = err
+		c.nextAttempt = now.Add(c.delay)
+		return fmt.Errorf("reconnect failed, retrying in %v: %w", c.delay, err)
+	}
+	if c.delay != 0 {
+		glog.Infof("modbus connection reestablished")
+	}
+	c.connected = true
+	c.delay = 0
+	c.lastErr = nil
+	return nil
+}
+
+// isConnectionError reports whether err indicates that the connection should
+// be reopened. A Modbus exception or a corrupted response means the device
+// answered, so the connection is fine. A timeout means only that the addressed
+// unit did not answer.
+func isConnectionError(err error) bool {
+	err = classifyError(err)
+	var exception *ExceptionError
+	return !errors.As(err, &exception) && !errors.Is(err, ErrCRCMismatch) && !errors.Is(err, ErrTimeout)
+}
+
+// setSlaveID sets the unit that requests from h are addressed to.
+func setSlaveID(h connHandler, unit byte) {
+	switch h := h.(type) {
+	case *rtuSerialHandler:
+		h.SlaveId = unit
+	case *modbus.TCPClientHandler:
+		h.SlaveId = unit
+	case *rtuOverTCPHandler:
+		h.SlaveId = unit
+	case *captureHandler:
+		setSlaveID(h.connHandler, unit)
+	}
+}
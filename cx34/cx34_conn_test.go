@@ -0,0 +1,270 @@
+package cx34
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goburrow/serial"
+)
+
+// testHandler is a connHandler whose requests all fail with err, and whose
+// connection attempts fail with connectErr.
+type testHandler struct {
+	rtuPackager
+	err, connectErr  error
+	connects, closes int
+}
+
+func (h *testHandler) Connect() error                  { h.connects++; return h.connectErr }
+func (h *testHandler) Close() error                    { h.closes++; return nil }
+func (h *testHandler) Send(adu []byte) ([]byte, error) { return nil, h.err }
+
+func TestConnKeepsConnectionOnTimeout(t *testing.T) {
+	_, crcErr := decodeFrame([]byte{0x01, 0x03, 0xab, 0x12})
+	tests := []struct {
+		err       error
+		reconnect bool
+	}{
+		{serial.ErrTimeout, false},
+		{crcErr, false},
+		{io.ErrUnexpectedEOF, true},
+	}
+	for _, tt := range tests {
+		h := &testHandler{err: tt.err}
+		c := newConn(h, &Params{UnitId: 1})
+		if err := c.connect(); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := c.ReadHoldingRegisters(140, 1); err == nil {
+				t.Fatalf("ReadHoldingRegisters succeeded, want %v", tt.err)
+			}
+		}
+		if dropped := h.closes > 0; dropped != tt.reconnect {
+			t.Errorf("after %v: connection dropped = %t, want %t", tt.err, dropped, tt.reconnect)
+		}
+	}
+}
+
+// serveUnit answers Modbus RTU reads addressed to unit on every connection
+// accepted from l, with every register holding 1, and ignores requests for
+// other units. It counts the
+// connections accepted.
+func serveUnit(l net.Listener, unit byte, accepted *int32) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(accepted, 1)
+		go func() {
+			defer conn.Close()
+			var request [8]byte
+			for {
+				if _, err := io.ReadFull(conn, request[:]); err != nil {
+					return
+				}
+				if request[0] != unit {
+					continue
+				}
+				quantity := binary.BigEndian.Uint16(request[4:])
+				response := []byte{unit, request[1], byte(2 * quantity)}
+				for i := 0; i < int(quantity); i++ {
+					response = append(response, 0, 1)
+				}
+				crc := rtuChecksum(response)
+				response = binary.LittleEndian.AppendUint16(response, crc)
+				if _, err := conn.Write(response); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func TestSilentUnitKeepsSharedConnection(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	var accepted int32
+	go serveUnit(l, 1, &accepted)
+
+	h := newRTUOverTCPHandler(l.Addr().String())
+	h.Timeout = 100 * time.Millisecond
+	c := newConn(h, &Params{UnitId: 1})
+	defer c.Close()
+	read := func(unit byte) ([]byte, error) {
+		return c.do(unit, func() ([]byte, error) {
+			return c.client.ReadHoldingRegisters(140, 1)
+		})
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := read(2); !errors.Is(classifyError(err), ErrTimeout) {
+			t.Fatalf("read from silent unit: got %v, want a timeout", err)
+		}
+		results, err := read(1)
+		if err != nil {
+			t.Fatalf("read from unit 1 after a timeout: %v", err)
+		}
+		if len(results) != 2 || results[1] != 1 {
+			t.Fatalf("read from unit 1 = % x, want 00 01", results)
+		}
+	}
+	if n := atomic.LoadInt32(&accepted); n != 1 {
+		t.Errorf("server accepted %d connections, want 1", n)
+	}
+}
+
+func TestConnReconnectBackoff(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	h := &testHandler{connectErr: errRefused}
+	c := newConn(h, &Params{UnitId: 1, MinReconnectDelay: time.Second, MaxReconnectDelay: 5 * time.Second})
+	now := time.Date(2021, time.January, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	ok := func() ([]byte, error) { return nil, nil }
+
+	// Each failed attempt doubles the delay before the next, up to the maximum.
+	for i, want := range []time.Duration{1, 2, 4, 5, 5} {
+		want *= time.Second
+		if _, err := c.do(1, ok); !errors.Is(err, errRefused) {
+			t.Fatalf("attempt %d: got %v, want %v", i+1, err, errRefused)
+		}
+		if h.connects != i+1 {
+			t.Fatalf("attempt %d: %d connection attempts, want %d", i+1, h.connects, i+1)
+		}
+		if got := c.nextAttempt.Sub(now); got != want {
+			t.Errorf("attempt %d: next attempt in %v, want %v", i+1, got, want)
+		}
+		// Until then, requests fail without trying to connect.
+		now = now.Add(want - time.Millisecond)
+		if _, err := c.do(1, ok); !errors.Is(err, errRefused) || h.connects != i+1 {
+			t.Fatalf("attempt %d: request during backoff got %v after %d connection attempts", i+1, err, h.connects)
+		}
+		now = now.Add(time.Millisecond)
+	}
+
+	// Success resets the delay.
+	h.connectErr = nil
+	if _, err := c.do(1, ok); err != nil {
+		t.Fatalf("reconnecting: %v", err)
+	}
+	h.err = io.ErrUnexpectedEOF
+	if _, err := c.ReadHoldingRegisters(140, 1); err == nil {
+		t.Fatal("ReadHoldingRegisters succeeded, want an error")
+	}
+	h.connectErr = errRefused
+	if _, err := c.do(1, ok); !errors.Is(err, errRefused) {
+		t.Fatalf("got %v, want %v", err, errRefused)
+	}
+	if got := c.nextAttempt.Sub(now); got != time.Second {
+		t.Errorf("after reconnecting once: next attempt in %v, want 1s", got)
+	}
+}
+
+// serveTwoUnits answers Modbus RTU reads on every connection accepted from
+// l. Unit 1 answers every read. Unit 2 answers reads of register 300 with an
+// illegal data address exception, ignores reads of register 301, and answers
+// the rest.
+func serveTwoUnits(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			var request [8]byte
+			for {
+				if _, err := io.ReadFull(conn, request[:]); err != nil {
+					return
+				}
+				unit := request[0]
+				address := binary.BigEndian.Uint16(request[2:])
+				quantity := binary.BigEndian.Uint16(request[4:])
+				var response []byte
+				switch {
+				case unit == 2 && address == 300:
+					response = []byte{unit, request[1] | 0x80, 0x02}
+				case unit == 2 && address == 301:
+					continue
+				default:
+					response = []byte{unit, request[1], byte(2 * quantity)}
+					for i := 0; i < int(quantity); i++ {
+						response = append(response, 0, unit)
+					}
+				}
+				response = binary.LittleEndian.AppendUint16(response, rtuChecksum(response))
+				if _, err := conn.Write(response); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func TestBusStatsPerUnit(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go serveTwoUnits(l)
+
+	b, err := OpenBus(&Params{Mode: Modbus, Address: "rtu-over-tcp://" + l.Addr().String(), Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	unit1, unit2 := b.Client(1), b.Client(2)
+	read := func(c *Client, reg Register) error {
+		_, err := c.ReadRegisters(RegisterRange{reg, reg})
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := read(unit1, 140); err != nil {
+			t.Fatalf("unit 1: %v", err)
+		}
+	}
+	if err := read(unit2, 140); err != nil {
+		t.Fatalf("unit 2: %v", err)
+	}
+	if err := read(unit2, 300); !errors.Is(err, ErrIllegalAddress) {
+		t.Fatalf("unit 2 register 300: got %v, want ErrIllegalAddress", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := read(unit2, 301); !errors.Is(err, ErrTimeout) {
+			t.Fatalf("unit 2 register 301: got %v, want ErrTimeout", err)
+		}
+	}
+	// Unit 2 timing out leaves the connection usable for unit 1.
+	if err := read(unit1, 141); err != nil {
+		t.Fatalf("unit 1 after unit 2 timed out: %v", err)
+	}
+
+	stats := b.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("stats for %d units, want 2", len(stats))
+	}
+	s1, s2 := stats[1], stats[2]
+	if s1.Requests != 4 || s1.Errors != 0 || s1.Timeouts != 0 || s1.LastError != nil || s1.LastSuccess.IsZero() {
+		t.Errorf("unit 1 stats = %+v, want 4 requests and no errors", s1)
+	}
+	if s2.Requests != 4 || s2.Errors != 3 || s2.Timeouts != 2 || s2.Exceptions != 1 || s2.CRCErrors != 0 {
+		t.Errorf("unit 2 stats = %+v, want 4 requests, 3 errors, 2 timeouts and 1 exception", s2)
+	}
+	if !errors.Is(classifyError(s2.LastError), ErrTimeout) {
+		t.Errorf("unit 2 last error = %v, want a timeout", s2.LastError)
+	}
+	if s2.Busy < 2*100*time.Millisecond {
+		t.Errorf("unit 2 busy for %v, want at least its two timeouts", s2.Busy)
+	}
+}
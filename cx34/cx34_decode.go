@@ -0,0 +1,160 @@
+package cx34
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goburrow/modbus"
+)
+
+// RegisterInfo describes a holding register.
+type RegisterInfo struct {
+	Register Register
+	Name     string
+	// Scale multiplies the raw value to give a value in Unit. Zero means 1.
+	Scale float64
+	// Unit of the scaled value, such as "°C", or empty for plain numbers,
+	// switches and codes.
+	Unit string
+	// Signed registers hold two's-complement values.
+	Signed bool
+	// Min and Max are the documented range of the scaled value. Both are
+	// zero if the range is unknown.
+	Min, Max float64
+	// Writable registers can be changed over Modbus.
+	Writable bool
+	// Hex registers hold bit fields or codes, best shown in hexadecimal.
+	Hex         bool
+	Description string
+	// Source is the document, and page, the information comes from.
+	Source string
+}
+
+// Decode returns the value in Unit of the raw register value.
+func (info RegisterInfo) Decode(raw uint16) float64 {
+	v := float64(raw)
+	if info.Signed {
+		v = float64(int16(raw))
+	}
+	switch {
+	case info.Scale == 0 || info.Scale == 1:
+		return v
+	case info.Scale < 1:
+		// Dividing keeps values like 0.1°C exact when printed.
+		return v / (1 / info.Scale)
+	}
+	return v * info.Scale
+}
+
+// Format returns the raw register value in Unit, as text.
+func (info RegisterInfo) Format(raw uint16) string {
+	if info.Hex {
+		return fmt.Sprintf("%#04x", raw)
+	}
+	return strconv.FormatFloat(info.Decode(raw), 'f', -1, 64) + info.Unit
+}
+
+// InRange reports whether the raw register value is within the documented
+// range, or the range is unknown.
+func (info RegisterInfo) InRange(raw uint16) bool {
+	if info.Min == 0 && info.Max == 0 {
+		return true
+	}
+	v := info.Decode(raw)
+	return v >= info.Min && v <= info.Max
+}
+
+// registerInfo indexes registerTable by register and by name.
+var (
+	registerInfo       = make(map[Register]*RegisterInfo)
+	registerInfoByName = make(map[string]*RegisterInfo)
+)
+
+func init() {
+	for i := range registerTable {
+		info := &registerTable[i]
+		registerInfo[info.Register] = info
+		registerInfoByName[info.Name] = info
+	}
+}
+
+// LookupRegister returns what is known about reg.
+func LookupRegister(reg Register) (RegisterInfo, bool) {
+	info, ok := registerInfo[reg]
+	if !ok {
+		return RegisterInfo{}, false
+	}
+	return *info, true
+}
+
+// LookupRegisterName returns what is known about the register called name.
+func LookupRegisterName(name string) (RegisterInfo, bool) {
+	info, ok := registerInfoByName[name]
+	if !ok {
+		return RegisterInfo{}, false
+	}
+	return *info, true
+}
+
+// KnownRegisters returns what is known about every named register, in
+// register order.
+func KnownRegisters() []RegisterInfo {
+	infos := append([]RegisterInfo(nil), registerTable...)
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Register < infos[j].Register })
+	return infos
+}
+
+// DecodeRegister returns the raw value of reg in the unit given by its
+// RegisterInfo, or unchanged if nothing is known about reg.
+func DecodeRegister(reg Register, raw uint16) float64 {
+	if info, ok := registerInfo[reg]; ok {
+		return info.Decode(raw)
+	}
+	return float64(raw)
+}
+
+// FormatRegister returns the raw value of reg as text in the unit given by
+// its RegisterInfo.
+func FormatRegister(reg Register, raw uint16) string {
+	if reg == ACMode {
+		return AirConditioningMode(raw).String()
+	}
+	if info, ok := registerInfo[reg]; ok {
+		return info.Format(raw)
+	}
+	return strconv.Itoa(int(raw))
+}
+
+// String describes the transaction, for example
+// "unit 1 READ 200-201 -> OutPipeTemp=2.2°C CompressorDischargeTemp=70°C".
+func (tx *rtuTransaction) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "unit %d ", tx.unit)
+	switch tx.functionCode {
+	case modbus.FuncCodeReadHoldingRegisters:
+		b.WriteString("READ")
+	case modbus.FuncCodeReadInputRegisters:
+		b.WriteString("READ INPUT")
+	case modbus.FuncCodeWriteSingleRegister, modbus.FuncCodeWriteMultipleRegisters:
+		b.WriteString("WRITE")
+	default:
+		fmt.Fprintf(&b, "FUNCTION %d", tx.functionCode)
+	}
+	if tx.quantity == 1 {
+		fmt.Fprintf(&b, " %d", tx.first)
+	} else {
+		fmt.Fprintf(&b, " %v", RegisterRange{tx.first, tx.first + Register(tx.quantity-1)})
+	}
+	b.WriteString(" ->")
+	if tx.exception != 0 {
+		fmt.Fprintf(&b, " %v", &ExceptionError{tx.functionCode, tx.exception})
+		return b.String()
+	}
+	for i, v := range tx.values {
+		reg := tx.first + Register(i)
+		fmt.Fprintf(&b, " %v=%s", reg, FormatRegister(reg, v))
+	}
+	return b.String()
+}
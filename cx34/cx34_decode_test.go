@@ -0,0 +1,64 @@
+package cx34
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// withCRC returns the frame b followed by its CRC.
+func withCRC(b ...byte) []byte {
+	return binary.LittleEndian.AppendUint16(b, rtuChecksum(b))
+}
+
+func TestTransactionString(t *testing.T) {
+	tests := []struct {
+		name              string
+		request, response []byte
+		want              string
+	}{
+		{
+			name:     "read setpoints",
+			request:  mustDecodeHex(t, hexReadSetpoints),
+			response: mustDecodeHex(t, hexSetpoints),
+			want:     "unit 1 READ 140-144 -> OnOffMode=1 ACMode=Heating TargetACCoolingModeTemp=12°C TargetACHeatingModeTemp=39°C TargetDomesticHotWaterTemp=51°C",
+		},
+		{
+			// Raw values -23, 700 and 125, in tenths of a degree.
+			name:     "read scaled sensors from unit 3",
+			request:  withCRC(3, 0x03, 0x00, 0xc8, 0x00, 0x03),
+			response: withCRC(3, 0x03, 0x06, 0xff, 0xe9, 0x02, 0xbc, 0x00, 0x7d),
+			want:     "unit 3 READ 200-202 -> OutPipeTemp=-2.3°C CompressorDischargeTemp=70°C AmbientTemp=12.5°C",
+		},
+		{
+			name:     "write single register",
+			request:  withCRC(2, 0x06, 0x00, 0x8f, 0x00, 0x28),
+			response: withCRC(2, 0x06, 0x00, 0x8f, 0x00, 0x28),
+			want:     "unit 2 WRITE 143 -> TargetACHeatingModeTemp=40°C",
+		},
+		{
+			name:     "write multiple registers",
+			request:  mustDecodeHex(t, hexWriteHeatingTemp),
+			response: mustDecodeHex(t, hexWroteHeatingTemp),
+			want:     "unit 1 WRITE 143 -> TargetACHeatingModeTemp=40°C",
+		},
+		{
+			name:     "exception",
+			request:  withCRC(1, 0x03, 0x01, 0x2c, 0x00, 0x01),
+			response: withCRC(1, 0x83, 0x02),
+			want:     "unit 1 READ 300 -> modbus exception 2 (illegal data address) for function 3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tr rtuTracker
+			tr.observe(tt.request)
+			txn, d := tr.observe(tt.response)
+			if d != DirectionResponse || txn == nil {
+				t.Fatalf("response observed as %v, transaction %v", d, txn)
+			}
+			if got := txn.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package cx34
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+// Error classes returned by Client methods. Test for them with errors.Is.
+var (
+	// ErrTimeout means the heat pump did not answer within the timeout.
+	ErrTimeout = errors.New("cx34: timed out waiting for response")
+	// ErrCRCMismatch means a response arrived but failed its CRC check,
+	// typically due to noise on the RS-485 line.
+	ErrCRCMismatch = errors.New("cx34: response CRC mismatch")
+
+	// ErrIllegalFunction, ErrIllegalAddress, ErrIllegalValue and
+	// ErrDeviceBusy match an ExceptionError with the corresponding
+	// Modbus exception code.
+	ErrIllegalFunction = errors.New("cx34: illegal function")
+	ErrIllegalAddress  = errors.New("cx34: illegal data address")
+	ErrIllegalValue    = errors.New("cx34: illegal data value")
+	ErrDeviceBusy      = errors.New("cx34: device busy")
+
+	// ErrVerify matches a *WriteMismatchError: a written register did not
+	// read back as written.
+	ErrVerify = errors.New("cx34: register does not read back as written")
+
+	// ErrReplayMismatch means a Replay was sent a request other than the
+	// next one in its capture, or ran out of captured requests. Sending it
+	// again cannot help.
+	ErrReplayMismatch = errors.New("cx34: request does not match capture")
+)
+
+// ExceptionError is a Modbus exception response: the heat pump received the
+// request but refused it.
+type ExceptionError struct {
+	FunctionCode  byte
+	ExceptionCode byte
+}
+
+func (e *ExceptionError) Error() string {
+	return fmt.Sprintf("modbus exception %d (%s) for function %d", e.ExceptionCode, e.name(), e.FunctionCode&^0x80)
+}
+
+func (e *ExceptionError) name() string {
+	switch e.ExceptionCode {
+	case modbus.ExceptionCodeIllegalFunction:
+		return "illegal function"
+	case modbus.ExceptionCodeIllegalDataAddress:
+		return "illegal data address"
+	case modbus.ExceptionCodeIllegalDataValue:
+		return "illegal data value"
+	case modbus.ExceptionCodeServerDeviceFailure:
+		return "device failure"
+	case modbus.ExceptionCodeAcknowledge:
+		return "acknowledge"
+	case modbus.ExceptionCodeServerDeviceBusy:
+		return "device busy"
+	case modbus.ExceptionCodeGatewayPathUnavailable:
+		return "gateway path unavailable"
+	case modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond:
+		return "gateway target failed to respond"
+	}
+	return "unknown"
+}
+
+// Is reports whether the exception code corresponds to target.
+func (e *ExceptionError) Is(target error) bool {
+	switch target {
+	case ErrIllegalFunction:
+		return e.ExceptionCode == modbus.ExceptionCodeIllegalFunction
+	case ErrIllegalAddress:
+		return e.ExceptionCode == modbus.ExceptionCodeIllegalDataAddress
+	case ErrIllegalValue:
+		return e.ExceptionCode == modbus.ExceptionCodeIllegalDataValue
+	case ErrDeviceBusy:
+		return e.ExceptionCode == modbus.ExceptionCodeServerDeviceBusy
+	case ErrTimeout:
+		// A gateway reports a silent slave this way.
+		return e.ExceptionCode == modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond
+	}
+	return false
+}
+
+// WriteMismatchError is returned when Params.VerifyWrites is set and a
+// register reads back a different value than was written, for example
+// because the controller clamped or rejected the value.
+type WriteMismatchError struct {
+	Register Register
+	Wrote    uint16
+	ReadBack uint16
+}
+
+func (e *WriteMismatchError) Error() string {
+	return fmt.Sprintf("register %v reads back %d after writing %d", e.Register, e.ReadBack, e.Wrote)
+}
+
+// Is reports whether target is ErrVerify.
+func (e *WriteMismatchError) Is(target error) bool { return target == ErrVerify }
+
+// classifiedError attaches one of the error classes above to an error that
+// does not carry it itself.
+type classifiedError struct {
+	class error
+	err   error
+}
+
+func (e *classifiedError) Error() string        { return e.err.Error() }
+func (e *classifiedError) Unwrap() error        { return e.err }
+func (e *classifiedError) Is(target error) bool { return target == e.class }
+
+// classifyError maps transport errors onto the error classes above.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var modbusErr *modbus.ModbusError
+	if errors.As(err, &modbusErr) {
+		return &ExceptionError{FunctionCode: modbusErr.FunctionCode, ExceptionCode: modbusErr.ExceptionCode}
+	}
+	if errors.Is(err, ErrTimeout) || errors.Is(err, ErrCRCMismatch) {
+		return err
+	}
+	var netErr net.Error
+	if errors.Is(err, serial.ErrTimeout) || errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &classifiedError{ErrTimeout, err}
+	}
+	return err
+}
+
+// isRetryable reports whether a request that failed with err may succeed if
+// sent again.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrClosed) ||
+		errors.Is(err, ErrReplayMismatch) {
+		return false
+	}
+	var exception *ExceptionError
+	if errors.As(err, &exception) {
+		return errors.Is(err, ErrDeviceBusy) || errors.Is(err, ErrTimeout) ||
+			exception.ExceptionCode == modbus.ExceptionCodeAcknowledge
+	}
+	return true
+}
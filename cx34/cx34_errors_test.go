@@ -0,0 +1,163 @@
+package cx34
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+// netTimeout is a net.Error that timed out.
+type netTimeout struct{}
+
+func (netTimeout) Error() string   { return "i/o timeout" }
+func (netTimeout) Timeout() bool   { return true }
+func (netTimeout) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	_, crcErr := decodeFrame([]byte{0x01, 0x03, 0xab, 0x12})
+	_, serialCRCErr := (&rtuSerialHandler{modbus.NewRTUClientHandler("")}).Decode([]byte{0x01, 0x03, 0xab, 0x12})
+	classes := []error{ErrTimeout, ErrCRCMismatch, ErrIllegalFunction, ErrIllegalAddress, ErrIllegalValue, ErrDeviceBusy}
+	tests := []struct {
+		name string
+		err  error
+		want error // nil if err belongs to no class
+	}{
+		{"illegal function", &modbus.ModbusError{FunctionCode: 0x83, ExceptionCode: 1}, ErrIllegalFunction},
+		{"illegal address", &modbus.ModbusError{FunctionCode: 0x83, ExceptionCode: 2}, ErrIllegalAddress},
+		{"illegal value", &modbus.ModbusError{FunctionCode: 0x86, ExceptionCode: 3}, ErrIllegalValue},
+		{"device busy", &modbus.ModbusError{FunctionCode: 0x83, ExceptionCode: 6}, ErrDeviceBusy},
+		{"gateway target silent", &modbus.ModbusError{FunctionCode: 0x83, ExceptionCode: 0x0b}, ErrTimeout},
+		{"device failure", &modbus.ModbusError{FunctionCode: 0x83, ExceptionCode: 4}, nil},
+		{"serial timeout", serial.ErrTimeout, ErrTimeout},
+		{"deadline", os.ErrDeadlineExceeded, ErrTimeout},
+		{"network timeout", netTimeout{}, ErrTimeout},
+		{"CRC", crcErr, ErrCRCMismatch},
+		{"serial CRC", serialCRCErr, ErrCRCMismatch},
+		{"already classified", ErrTimeout, ErrTimeout},
+		{"closed connection", io.ErrUnexpectedEOF, nil},
+	}
+	for _, tt := range tests {
+		got := classifyError(tt.err)
+		for _, class := range classes {
+			if is := errors.Is(got, class); is != (class == tt.want) {
+				t.Errorf("%s: errors.Is(classifyError(%v), %v) = %t", tt.name, tt.err, class, is)
+			}
+		}
+	}
+	if classifyError(nil) != nil {
+		t.Errorf("classifyError(nil) != nil")
+	}
+	var exception *ExceptionError
+	if got := classifyError(&modbus.ModbusError{FunctionCode: 0x83, ExceptionCode: 2}); !errors.As(got, &exception) || exception.ExceptionCode != 2 {
+		t.Errorf("classifyError of an exception = %v, want an ExceptionError with code 2", got)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&classifiedError{ErrTimeout, serial.ErrTimeout}, true},
+		{&classifiedError{ErrCRCMismatch, errors.New("bad crc")}, true},
+		{io.ErrUnexpectedEOF, true},
+		{&ExceptionError{FunctionCode: 3, ExceptionCode: modbus.ExceptionCodeServerDeviceBusy}, true},
+		{&ExceptionError{FunctionCode: 3, ExceptionCode: modbus.ExceptionCodeAcknowledge}, true},
+		{&ExceptionError{FunctionCode: 3, ExceptionCode: modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond}, true},
+		{&ExceptionError{FunctionCode: 3, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}, false},
+		{&ExceptionError{FunctionCode: 6, ExceptionCode: modbus.ExceptionCodeIllegalDataValue}, false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+		{ErrClosed, false},
+		{ErrReplayMismatch, false},
+	}
+	for _, tt := range tests {
+		if got := isRetryable(tt.err); got != tt.want {
+			t.Errorf("isRetryable(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+// flakyTransport fails reads with the errors in errs, one per read, then
+// succeeds. It counts the reads.
+type flakyTransport struct {
+	testTransport
+	errs  []error
+	reads int
+}
+
+func (t *flakyTransport) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	t.reads++
+	if len(t.errs) > 0 {
+		err := t.errs[0]
+		t.errs = t.errs[1:]
+		return nil, err
+	}
+	return t.testTransport.ReadHoldingRegisters(address, quantity)
+}
+
+func TestClientRetries(t *testing.T) {
+	busy := &modbus.ModbusError{FunctionCode: 0x83, ExceptionCode: 6}
+	illegal := &modbus.ModbusError{FunctionCode: 0x83, ExceptionCode: 2}
+	tests := []struct {
+		name      string
+		errs      []error
+		wantReads int
+		wantErr   error
+	}{
+		{"success", nil, 1, nil},
+		{"timeouts then success", []error{serial.ErrTimeout, serial.ErrTimeout}, 3, nil},
+		{"timeouts", []error{serial.ErrTimeout, serial.ErrTimeout, serial.ErrTimeout}, 3, ErrTimeout},
+		{"busy then success", []error{busy}, 2, nil},
+		{"illegal address", []error{illegal, illegal}, 1, ErrIllegalAddress},
+		{"replay mismatch", []error{ErrReplayMismatch, ErrReplayMismatch}, 1, ErrReplayMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &flakyTransport{errs: tt.errs}
+			c := NewClient(tr, &Params{Retry: RetryPolicy{Attempts: 3}})
+			_, err := c.ReadRegisters(RegisterRange{OnOffMode, OnOffMode})
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("ReadRegisters = %v, want success", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReadRegisters = %v, want %v", err, tt.wantErr)
+			}
+			if tr.reads != tt.wantReads {
+				t.Errorf("sent %d reads, want %d", tr.reads, tt.wantReads)
+			}
+		})
+	}
+}
+
+func TestClientRetryBackoffCancelled(t *testing.T) {
+	tr := &flakyTransport{errs: []error{serial.ErrTimeout, serial.ErrTimeout}}
+	c := NewClient(tr, &Params{Retry: RetryPolicy{Attempts: 3, Backoff: time.Hour}})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.ReadRegistersContext(ctx, RegisterRange{OnOffMode, OnOffMode}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ReadRegisters = %v, want the context's error while backing off", err)
+	}
+	if tr.reads != 1 {
+		t.Errorf("sent %d reads, want 1", tr.reads)
+	}
+}
+
+func TestClientRetryBackoffDoubles(t *testing.T) {
+	tr := &flakyTransport{errs: []error{serial.ErrTimeout, serial.ErrTimeout}}
+	c := NewClient(tr, &Params{Retry: RetryPolicy{Attempts: 3, Backoff: 20 * time.Millisecond}})
+	start := time.Now()
+	if _, err := c.ReadRegisters(RegisterRange{OnOffMode, OnOffMode}); err != nil {
+		t.Fatal(err)
+	}
+	// 20ms before the first retry and 40ms before the second.
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("two retries took %v, want at least 60ms of backoff", elapsed)
+	}
+}
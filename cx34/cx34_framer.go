@@ -0,0 +1,254 @@
+package cx34
+
+import (
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/golang/glog"
+)
+
+// RTUFrame is a Modbus RTU frame received on a serial line.
+type RTUFrame struct {
+	// Time is when the first byte of the frame was received. For a frame
+	// that shared a read with the bytes before it, this is the time of the
+	// read plus one character time for each of those bytes.
+	Time time.Time
+	// ADU is the frame itself, including slave address and CRC.
+	ADU []byte
+}
+
+// RTUFramer splits a raw serial byte stream into Modbus RTU frames.
+//
+// Modbus RTU marks the end of a frame with at least 3.5 character times of
+// silence on the line. Bytes are rarely delivered that precisely: USB
+// adapters hold received bytes back for several milliseconds, which splits
+// frames, and busy readers collect several frames in one read. So silence is
+// only taken to end a frame if the bytes before it have a valid CRC;
+// otherwise the framer resynchronizes by searching the buffered bytes for
+// frames with a valid CRC.
+type RTUFramer struct {
+	gap      time.Duration
+	charTime time.Duration
+	buf      []byte
+	arrivals []rtuArrival // when each read of the buffered bytes was received
+	last     time.Time    // when the last buffered byte was received
+}
+
+// rtuArrival records that the buffered bytes from offset on were received at
+// time t.
+type rtuArrival struct {
+	offset int
+	t      time.Time
+}
+
+// NewRTUFramer returns a framer for a line running at baud. If baud is 0,
+// the default of 9600 baud is assumed.
+func NewRTUFramer(baud int) *RTUFramer {
+	if baud <= 0 {
+		baud = baudRate
+	}
+	// A character is 11 bits: start, 8 data, parity or second stop, stop.
+	// Above 19200 baud the specification fixes the gap at 1.75ms.
+	charTime := time.Duration(11 * float64(time.Second) / float64(baud))
+	gap := 1750 * time.Microsecond
+	if baud <= 19200 {
+		gap = time.Duration(3.5 * float64(charTime))
+	}
+	return &RTUFramer{gap: gap, charTime: charTime}
+}
+
+// Feed adds the bytes p received at time t, and returns the frames that the
+// silence before them ended.
+func (f *RTUFramer) Feed(t time.Time, p []byte) []RTUFrame {
+	if len(p) == 0 {
+		return nil
+	}
+	var frames []RTUFrame
+	if len(f.buf) > 0 && t.Sub(f.last) >= f.gap {
+		frames = f.split()
+	}
+	if len(f.buf) == 0 {
+		f.arrivals = f.arrivals[:0]
+	}
+	f.arrivals = append(f.arrivals, rtuArrival{len(f.buf), t})
+	f.buf = append(f.buf, p...)
+	f.last = t
+	return frames
+}
+
+// Flush returns the frames in the buffered bytes and discards the rest. Call
+// it when the line has been idle, such as after a read timeout, or at the
+// end of a capture.
+func (f *RTUFramer) Flush() []RTUFrame {
+	frames := f.split()
+	if len(f.buf) > 0 {
+		glog.V(1).Infof("discarding %d bytes that are not a Modbus RTU frame: % x", len(f.buf), f.buf)
+	}
+	f.buf = nil
+	f.arrivals = nil
+	return frames
+}
+
+// split removes the frames at the start of the buffer, keeping any trailing
+// bytes that may be the start of a frame still arriving.
+func (f *RTUFramer) split() []RTUFrame {
+	if isRTUFrameLength(f.buf) {
+		if _, err := decodeFrame(f.buf); err == nil {
+			frame := RTUFrame{f.timeAt(0), f.buf}
+			f.buf = nil
+			return []RTUFrame{frame}
+		}
+	}
+	var sc rtuScanner
+	var frames []RTUFrame
+	for _, sf := range sc.feed(f.buf) {
+		frames = append(frames, RTUFrame{f.timeAt(sf.offset), sf.adu})
+	}
+	f.dropArrivals(sc.offset)
+	f.buf = sc.buf
+	return frames
+}
+
+// timeAt returns when the buffered byte at offset was received, assuming
+// the bytes of each read arrived one character time apart.
+func (f *RTUFramer) timeAt(offset int) time.Time {
+	a := f.arrivals[0]
+	for _, next := range f.arrivals[1:] {
+		if next.offset > offset {
+			break
+		}
+		a = next
+	}
+	return a.t.Add(time.Duration(offset-a.offset) * f.charTime)
+}
+
+// dropArrivals updates the arrival times for the removal of the first n
+// buffered bytes.
+func (f *RTUFramer) dropArrivals(n int) {
+	if n == 0 || len(f.arrivals) == 0 {
+		return
+	}
+	kept := []rtuArrival{{0, f.timeAt(n)}}
+	for _, a := range f.arrivals {
+		if a.offset > n {
+			kept = append(kept, rtuArrival{a.offset - n, a.t})
+		}
+	}
+	f.arrivals = kept
+}
+
+// rtuScanner splits a byte stream into RTU frames without timing
+// information, by looking for a valid CRC at the frame lengths allowed by
+// the function code. Bytes that cannot start a frame are skipped, which
+// resynchronizes the scanner after noise or a partial frame.
+type rtuScanner struct {
+	buf    []byte
+	offset int // position of buf[0] in the bytes fed
+}
+
+// scannedFrame is a frame found by rtuScanner, and its position in the bytes
+// fed.
+type scannedFrame struct {
+	offset int
+	adu    []byte
+}
+
+// feed appends p to the buffered bytes and returns the complete frames found.
+func (s *rtuScanner) feed(p []byte) []scannedFrame {
+	s.buf = append(s.buf, p...)
+	var frames []scannedFrame
+	for {
+		n, ok := s.next()
+		if !ok {
+			break
+		}
+		if n == 0 {
+			s.buf = s.buf[1:]
+			s.offset++
+			continue
+		}
+		frames = append(frames, scannedFrame{s.offset, append([]byte(nil), s.buf[:n]...)})
+		s.buf = s.buf[n:]
+		s.offset += n
+	}
+	// Don't let the buffer grow without bound on a long capture.
+	s.buf = append([]byte(nil), s.buf...)
+	return frames
+}
+
+// next returns the length of the frame at the start of the buffer, or 0 if
+// no frame can start there. It returns false if more bytes are needed to
+// tell.
+func (s *rtuScanner) next() (int, bool) {
+	lengths, ok := rtuFrameLengths(s.buf)
+	if !ok {
+		return 0, false
+	}
+	waiting := false
+	for _, n := range lengths {
+		if n > len(s.buf) {
+			waiting = true
+			continue
+		}
+		if _, err := decodeFrame(s.buf[:n]); err == nil {
+			return n, true
+		}
+	}
+	if waiting {
+		return 0, false
+	}
+	return 0, true
+}
+
+// rtuFrameLengths returns the possible lengths, shortest first, of a request
+// or response frame starting with b. It returns false if more bytes are
+// needed to tell, and no lengths if b cannot start a frame used by the CX34.
+func rtuFrameLengths(b []byte) ([]int, bool) {
+	if len(b) < 2 {
+		return nil, false
+	}
+	if b[0] > LastUnitID {
+		return nil, true
+	}
+	functionCode := b[1]
+	switch {
+	case functionCode&0x80 != 0:
+		return []int{rtuExceptionSize}, true
+	case functionCode == modbus.FuncCodeReadHoldingRegisters,
+		functionCode == modbus.FuncCodeReadInputRegisters:
+		if len(b) < 3 {
+			return nil, false
+		}
+		return sortedLengths(8, 5+int(b[2])), true
+	case functionCode == modbus.FuncCodeWriteSingleRegister:
+		return []int{8}, true
+	case functionCode == modbus.FuncCodeWriteMultipleRegisters:
+		if len(b) < 7 {
+			return nil, false
+		}
+		return sortedLengths(8, 9+int(b[6])), true
+	}
+	return nil, true
+}
+
+// isRTUFrameLength reports whether b is as long as a frame starting with its
+// slave address and function code can be.
+func isRTUFrameLength(b []byte) bool {
+	lengths, ok := rtuFrameLengths(b)
+	if !ok {
+		return false
+	}
+	for _, n := range lengths {
+		if n == len(b) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedLengths(a, b int) []int {
+	if a > b {
+		return []int{b, a}
+	}
+	return []int{a, b}
+}
@@ -0,0 +1,205 @@
+package cx34
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Frames produced by the simulator, not captured from a heat pump: recorded
+// from chilctl -set-heating-temp 40C talking to chilctl simulate over a pty.
+const (
+	hexReadSetpoints     = "0103008c00054422"
+	hexSetpoints         = "01030a00010001000c00270033d9f9"
+	hexReadHeatingTemp   = "0103008f0001b5e1"
+	hexHeatingTemp       = "0103020027f85e"
+	hexWriteHeatingTemp  = "0110008f0001020028b971"
+	hexWroteHeatingTemp  = "0110008f00013022"
+	hexSetpointsAfterSet = "01030a00010001000c00280033e9fa"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// framesString formats frames as hex, one per frame, for comparison.
+func framesString(frames []RTUFrame) string {
+	var s []string
+	for _, f := range frames {
+		s = append(s, hex.EncodeToString(f.ADU))
+	}
+	return fmt.Sprint(s)
+}
+
+func TestRTUFramer(t *testing.T) {
+	type chunk struct {
+		after time.Duration // since the previous chunk
+		hex   string
+	}
+	// One character time at 9600 baud.
+	char := 11 * time.Second / 9600
+	tests := []struct {
+		name   string
+		chunks []chunk
+		want   []string
+		at     []time.Duration // when each frame was received
+	}{
+		{
+			name:   "single frame",
+			chunks: []chunk{{0, hexReadSetpoints}},
+			want:   []string{hexReadSetpoints},
+			at:     []time.Duration{0},
+		},
+		{
+			name: "request and response",
+			chunks: []chunk{
+				{0, hexReadHeatingTemp},
+				{30 * time.Millisecond, hexHeatingTemp},
+			},
+			want: []string{hexReadHeatingTemp, hexHeatingTemp},
+			at:   []time.Duration{0, 30 * time.Millisecond},
+		},
+		{
+			name:   "back-to-back frames in one read",
+			chunks: []chunk{{0, hexWriteHeatingTemp + hexWroteHeatingTemp + hexReadSetpoints + hexSetpointsAfterSet}},
+			want:   []string{hexWriteHeatingTemp, hexWroteHeatingTemp, hexReadSetpoints, hexSetpointsAfterSet},
+			at:     []time.Duration{0, 11 * char, 19 * char, 27 * char},
+		},
+		{
+			name: "frame split across reads",
+			chunks: []chunk{
+				{0, hexSetpoints[:10]},
+				{time.Millisecond, hexSetpoints[10:24]},
+				{time.Millisecond, hexSetpoints[24:]},
+			},
+			want: []string{hexSetpoints},
+			at:   []time.Duration{0},
+		},
+		{
+			name: "frame split by adapter latency",
+			chunks: []chunk{
+				{0, hexSetpoints[:16]},
+				{16 * time.Millisecond, hexSetpoints[16:]},
+				{30 * time.Millisecond, hexReadHeatingTemp},
+			},
+			want: []string{hexSetpoints, hexReadHeatingTemp},
+			at:   []time.Duration{0, 46 * time.Millisecond},
+		},
+		{
+			name: "resync after noise",
+			chunks: []chunk{
+				{0, "00ff55" + hexReadHeatingTemp},
+				{30 * time.Millisecond, hexHeatingTemp},
+			},
+			want: []string{hexReadHeatingTemp, hexHeatingTemp},
+			at:   []time.Duration{3 * char, 30 * time.Millisecond},
+		},
+		{
+			name: "resync after a truncated frame",
+			chunks: []chunk{
+				{0, hexSetpoints[:20]},
+				{30 * time.Millisecond, hexReadSetpoints},
+				{30 * time.Millisecond, hexSetpoints},
+			},
+			want: []string{hexReadSetpoints, hexSetpoints},
+			at:   []time.Duration{30 * time.Millisecond, 60 * time.Millisecond},
+		},
+		{
+			name: "frame left over after a split",
+			chunks: []chunk{
+				{0, hexReadHeatingTemp + hexSetpoints[:10]},
+				{30 * time.Millisecond, hexSetpoints[10:]},
+			},
+			want: []string{hexReadHeatingTemp, hexSetpoints},
+			at:   []time.Duration{0, 8 * char},
+		},
+		{
+			// 01 03 40 21 has a valid CRC, but is too short to be a read.
+			name:   "CRC-valid bytes of the wrong length",
+			chunks: []chunk{{0, "01034021"}},
+			want:   nil,
+		},
+	}
+	t0 := time.Date(2021, time.January, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewRTUFramer(9600)
+			now := t0
+			var got []RTUFrame
+			for _, c := range tt.chunks {
+				now = now.Add(c.after)
+				got = append(got, f.Feed(now, mustDecodeHex(t, c.hex))...)
+			}
+			got = append(got, f.Flush()...)
+			if framesString(got) != fmt.Sprint(tt.want) {
+				t.Errorf("frames %s, want %v", framesString(got), tt.want)
+			}
+			var at []time.Duration
+			for _, f := range got {
+				at = append(at, f.Time.Sub(t0))
+			}
+			if fmt.Sprint(at) != fmt.Sprint(tt.at) {
+				t.Errorf("frames received at %v, want %v", at, tt.at)
+			}
+		})
+	}
+}
+
+func TestRTUTracker(t *testing.T) {
+	var tr rtuTracker
+	observe := func(s string) (*rtuTransaction, Direction) {
+		return tr.observe(mustDecodeHex(t, s))
+	}
+
+	if _, d := observe(hexReadSetpoints); d != DirectionRequest {
+		t.Errorf("read request observed as %v", d)
+	}
+	txn, d := observe(hexSetpoints)
+	if d != DirectionResponse || txn == nil {
+		t.Fatalf("read response observed as %v, transaction %v", d, txn)
+	}
+	if txn.first != 140 || fmt.Sprint(txn.values) != "[1 1 12 39 51]" {
+		t.Errorf("read %d: %v, want 140: [1 1 12 39 51]", txn.first, txn.values)
+	}
+
+	if _, d := observe(hexWriteHeatingTemp); d != DirectionRequest {
+		t.Errorf("write request observed as %v", d)
+	}
+	txn, d = observe(hexWroteHeatingTemp)
+	if d != DirectionResponse || txn == nil {
+		t.Fatalf("write response observed as %v, transaction %v", d, txn)
+	}
+	if txn.first != 143 || fmt.Sprint(txn.values) != "[40]" {
+		t.Errorf("wrote %d: %v, want 143: [40]", txn.first, txn.values)
+	}
+}
+
+func TestRTUTrackerShortFrames(t *testing.T) {
+	// CRC-valid frames too short for their function code, each after a
+	// request that would be completed by a response with that code.
+	tests := []struct {
+		request string
+		frame   []byte
+	}{
+		{hexReadSetpoints, []byte{0x01, 0x03}},
+		{hexReadSetpoints, []byte{0x01, 0x03, 0x02}},
+		{"0106008f0028b83f", []byte{0x01, 0x06, 0x00}},
+		{hexWriteHeatingTemp, []byte{0x01, 0x10, 0x00, 0x8f}},
+		{hexReadSetpoints, []byte{0x01}},
+	}
+	for _, tt := range tests {
+		var tr rtuTracker
+		tr.observe(mustDecodeHex(t, tt.request))
+		crc := rtuChecksum(tt.frame)
+		frame := append(tt.frame, byte(crc), byte(crc>>8))
+		if txn, _ := tr.observe(frame); txn != nil {
+			t.Errorf("% x completed %v", frame, txn)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package cx34
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNoData is returned when reading from a passive connection before all of
+// the requested named registers have been observed.
+var ErrNoData = errors.New("cx34: no register values observed yet")
+
+// Monitor accumulates register values observed passively, for example by
+// listening to another bus master, and produces State snapshots from them.
+// It is safe for concurrent use.
+type Monitor struct {
+	mu     sync.Mutex
+	values map[Register]observation
+	// changed is closed and replaced whenever values are observed.
+	changed chan struct{}
+}
+
+// observation is a register value and when it was seen.
+type observation struct {
+	value uint16
+	time  time.Time
+}
+
+// NewMonitor returns an empty Monitor.
+func NewMonitor() *Monitor {
+	return &Monitor{
+		values:  make(map[Register]observation),
+		changed: make(chan struct{}),
+	}
+}
+
+// Observe records the values of consecutive registers starting at first, as
+// seen at time t.
+func (m *Monitor) Observe(t time.Time, first Register, values []uint16) {
+	if len(values) == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, v := range values {
+		m.values[first+Register(i)] = observation{v, t}
+	}
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// State returns a snapshot of every register observed so far, or nil if
+// nothing has been observed. Its collection time is when the oldest of its
+// values was observed.
+func (m *Monitor) State() *State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.values) == 0 {
+		return nil
+	}
+	s, _ := m.snapshot(nil, nil)
+	return s
+}
+
+// snapshot copies the observed values, limited to ranges unless ranges is
+// nil, and returns how many of the registers in await have not been
+// observed. Caller must hold the mutex.
+func (m *Monitor) snapshot(ranges []RegisterRange, await []Register) (*State, int) {
+	values := make(map[Register]uint16)
+	var oldest time.Time
+	add := func(reg Register, o observation) {
+		values[reg] = o.value
+		if oldest.IsZero() || o.time.Before(oldest) {
+			oldest = o.time
+		}
+	}
+	if ranges == nil {
+		for reg, o := range m.values {
+			add(reg, o)
+		}
+	}
+	for _, r := range ranges {
+		for reg := r.First; reg <= r.Last; reg++ {
+			if o, ok := m.values[reg]; ok {
+				add(reg, o)
+			}
+		}
+	}
+	missing := 0
+	for _, reg := range await {
+		if _, ok := m.values[reg]; !ok {
+			missing++
+		}
+	}
+	return &State{oldest, values}, missing
+}
+
+// awaitedRegisters returns the registers in ranges that read waits for. The
+// bus master need not ask for every register, and the gaps in the register
+// map are unlikely to be among those it does, so only named registers are
+// waited for, unless ranges holds none.
+func awaitedRegisters(ranges []RegisterRange) []Register {
+	var named, all []Register
+	for _, r := range ranges {
+		for reg := r.First; reg <= r.Last; reg++ {
+			all = append(all, reg)
+			if _, ok := registerInfo[reg]; ok {
+				named = append(named, reg)
+			}
+		}
+	}
+	if len(named) > 0 {
+		return named
+	}
+	return all
+}
+
+// read returns the observed values of the registers in ranges, or of every
+// register observed so far if ranges is nil. It waits for up to timeout for
+// each named register in ranges to be observed at least once; unnamed
+// registers are included if they have been observed.
+func (m *Monitor) read(ctx context.Context, ranges []RegisterRange, timeout time.Duration) (*State, error) {
+	var requested []RegisterRange
+	if ranges != nil {
+		var err error
+		if requested, err = mergeRanges(ranges); err != nil {
+			return nil, err
+		}
+	}
+	await := awaitedRegisters(requested)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		m.mu.Lock()
+		s, missing := m.snapshot(requested, await)
+		changed := m.changed
+		m.mu.Unlock()
+		if missing == 0 && len(s.registerValues) > 0 {
+			return s, nil
+		}
+		select {
+		case <-changed:
+		case <-waitCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if missing > 0 {
+				return nil, fmt.Errorf("%w: %d of the requested registers", ErrNoData, missing)
+			}
+			return nil, ErrNoData
+		}
+	}
+}
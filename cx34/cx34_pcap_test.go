@@ -0,0 +1,33 @@
+package cx34
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestPcapWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewPcapWriter(&buf)
+	t0 := time.Unix(1609502400, 123456789)
+	if err := w.WriteFrame(t0, DirectionRequest, mustDecodeHex(t, hexReadHeatingTemp)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFrame(t0.Add(28*time.Millisecond), DirectionResponse, mustDecodeHex(t, hexHeatingTemp)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "" +
+		// Global header: magic, version 2.4, zone and accuracy, snaplen
+		// 65535, link type 147 (LINKTYPE_USER0), all little-endian.
+		"d4c3b2a1" + "0200" + "0400" + "00000000" + "00000000" + "ffff0000" + "93000000" +
+		// Request: seconds 1609502400, 123456 microseconds, 8 bytes
+		// captured of 8.
+		"c00eef5f" + "40e20100" + "08000000" + "08000000" + hexReadHeatingTemp +
+		// Response 28ms later: 151456 microseconds, 7 bytes.
+		"c00eef5f" + "a04f0200" + "07000000" + "07000000" + hexHeatingTemp
+	if got := hex.EncodeToString(buf.Bytes()); got != want {
+		t.Errorf("wrote\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,147 @@
+package cx34
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RegisterRange is an inclusive range of holding registers.
+type RegisterRange struct {
+	First, Last Register
+}
+
+// Len returns the number of registers in the range.
+func (r RegisterRange) Len() int {
+	return int(r.Last) - int(r.First) + 1
+}
+
+// Contains reports whether reg is in the range.
+func (r RegisterRange) Contains(reg Register) bool {
+	return reg >= r.First && reg <= r.Last
+}
+
+func (r RegisterRange) String() string {
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// RegisterGroup is a named set of registers that are usually read together.
+type RegisterGroup struct {
+	Name   string
+	Ranges []RegisterRange
+}
+
+// Register groups for use with WithGroups.
+var (
+	// Parameters are the P parameters of the installer menu.
+	Parameters = RegisterGroup{"parameters", []RegisterRange{{firstHoldingRegister, OnOffMode - 1}}}
+	// Setpoints are the writable on/off, mode and target temperature registers.
+	Setpoints = RegisterGroup{"setpoints", []RegisterRange{{OnOffMode, TargetDomesticHotWaterTemp}}}
+	// Sensors are the C parameters from the details screen, plus the inferred
+	// tank and inlet temperatures and fault code.
+	Sensors = RegisterGroup{"sensors", []RegisterRange{{OutPipeTemp, CurrentFaultCode}}}
+	// AllRegisters is the full holding register range read by default.
+	AllRegisters = RegisterGroup{"all", []RegisterRange{{firstHoldingRegister, lastHoldingRegister}}}
+)
+
+// ReadOption restricts which registers ReadState reads.
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	ranges []RegisterRange
+}
+
+// WithGroups limits ReadState to the registers in the given groups.
+func WithGroups(groups ...RegisterGroup) ReadOption {
+	return func(o *readOptions) {
+		for _, g := range groups {
+			o.ranges = append(o.ranges, g.Ranges...)
+		}
+	}
+}
+
+// WithRanges limits ReadState to the given register ranges.
+func WithRanges(ranges ...RegisterRange) ReadOption {
+	return func(o *readOptions) {
+		o.ranges = append(o.ranges, ranges...)
+	}
+}
+
+// Modbus allows at most 125 registers in one ReadHoldingRegisters request.
+const maxRegistersPerRead = 125
+
+// defaultMaxReadGap is the largest run of unrequested registers that is read
+// and discarded to save a request.
+const defaultMaxReadGap = 16
+
+// planReads returns the ReadHoldingRegisters requests needed to read the
+// given ranges.
+//
+// Every requested register is covered by exactly one request, and every
+// request starts and ends on a requested register. No request is longer than
+// maxPerRead. Two requested registers share a request if no more than maxGap
+// unrequested registers lie between them and the request stays short enough;
+// the registers in between are read and discarded, which is cheaper than a
+// separate request.
+func planReads(ranges []RegisterRange, maxPerRead, maxGap int) ([]RegisterRange, error) {
+	if maxPerRead < 1 || maxPerRead > maxRegistersPerRead {
+		return nil, fmt.Errorf("registers per read %d is out of range 1-%d", maxPerRead, maxRegistersPerRead)
+	}
+	merged, err := mergeRanges(ranges)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []RegisterRange
+	for _, r := range merged {
+		first := int(r.First)
+		for first <= int(r.Last) {
+			n := len(plan)
+			if n > 0 && first-int(plan[n-1].Last)-1 <= maxGap && first-int(plan[n-1].First) < maxPerRead {
+				// Extend the previous request.
+				plan[n-1].Last = Register(minInt(int(r.Last), int(plan[n-1].First)+maxPerRead-1))
+			} else {
+				plan = append(plan, RegisterRange{Register(first), Register(minInt(int(r.Last), first+maxPerRead-1))})
+			}
+			first = int(plan[len(plan)-1].Last) + 1
+		}
+	}
+	return plan, nil
+}
+
+// mergeRanges sorts the ranges and merges overlapping and adjacent ones, so
+// that the result is disjoint with at least one register between ranges.
+func mergeRanges(ranges []RegisterRange) ([]RegisterRange, error) {
+	sorted := make([]RegisterRange, len(ranges))
+	copy(sorted, ranges)
+	for _, r := range sorted {
+		if r.First > r.Last {
+			return nil, fmt.Errorf("invalid register range %v", r)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].First < sorted[j].First })
+
+	var merged []RegisterRange
+	for _, r := range sorted {
+		if n := len(merged); n > 0 && int(r.First) <= int(merged[n-1].Last)+1 {
+			if r.Last > merged[n-1].Last {
+				merged[n-1].Last = r.Last
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged, nil
+}
+
+// inRanges reports whether reg lies in one of the sorted, disjoint ranges.
+func inRanges(ranges []RegisterRange, reg Register) bool {
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].Last >= reg })
+	return i < len(ranges) && ranges[i].Contains(reg)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
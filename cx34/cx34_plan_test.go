@@ -0,0 +1,181 @@
+package cx34
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPlanReads(t *testing.T) {
+	tests := []struct {
+		name       string
+		ranges     []RegisterRange
+		maxPerRead int
+		maxGap     int
+		want       []RegisterRange
+	}{
+		{
+			name:       "single range",
+			ranges:     []RegisterRange{{200, 210}},
+			maxPerRead: 125, maxGap: 16,
+			want: []RegisterRange{{200, 210}},
+		},
+		{
+			name:       "adjacent ranges",
+			ranges:     []RegisterRange{{200, 205}, {206, 210}},
+			maxPerRead: 125, maxGap: 16,
+			want: []RegisterRange{{200, 210}},
+		},
+		{
+			name:       "overlapping ranges",
+			ranges:     []RegisterRange{{200, 208}, {205, 215}},
+			maxPerRead: 125, maxGap: 16,
+			want: []RegisterRange{{200, 215}},
+		},
+		{
+			name:       "unsorted ranges far apart",
+			ranges:     []RegisterRange{{250, 260}, {200, 210}},
+			maxPerRead: 125, maxGap: 16,
+			want: []RegisterRange{{200, 210}, {250, 260}},
+		},
+		{
+			name:       "small gap is read through",
+			ranges:     []RegisterRange{{200, 205}, {215, 220}},
+			maxPerRead: 125, maxGap: 16,
+			want: []RegisterRange{{200, 220}},
+		},
+		{
+			name:       "gap of exactly maxGap is read through",
+			ranges:     []RegisterRange{{200, 200}, {217, 217}},
+			maxPerRead: 125, maxGap: 16,
+			want: []RegisterRange{{200, 217}},
+		},
+		{
+			name:       "gap of maxGap+1 is not",
+			ranges:     []RegisterRange{{200, 200}, {218, 218}},
+			maxPerRead: 125, maxGap: 16,
+			want: []RegisterRange{{200, 200}, {218, 218}},
+		},
+		{
+			name:       "no gaps allowed",
+			ranges:     []RegisterRange{{200, 200}, {202, 202}},
+			maxPerRead: 125, maxGap: 0,
+			want: []RegisterRange{{200, 200}, {202, 202}},
+		},
+		{
+			name:       "setpoints and sensors",
+			ranges:     append(Setpoints.Ranges, Sensors.Ranges...),
+			maxPerRead: 125, maxGap: 16,
+			want: []RegisterRange{{140, 144}, {200, 284}},
+		},
+		{
+			name:       "all registers split at 125",
+			ranges:     AllRegisters.Ranges,
+			maxPerRead: 125, maxGap: 16,
+			want: []RegisterRange{{1, 125}, {126, 250}, {251, 350}},
+		},
+		{
+			name:       "read through a gap stops at 125",
+			ranges:     []RegisterRange{{1, 100}, {110, 130}},
+			maxPerRead: 125, maxGap: 16,
+			want: []RegisterRange{{1, 125}, {126, 130}},
+		},
+		{
+			name:       "exactly 125 registers",
+			ranges:     []RegisterRange{{1, 125}},
+			maxPerRead: 125, maxGap: 16,
+			want: []RegisterRange{{1, 125}},
+		},
+		{
+			name:       "126 registers",
+			ranges:     []RegisterRange{{1, 126}},
+			maxPerRead: 125, maxGap: 16,
+			want: []RegisterRange{{1, 125}, {126, 126}},
+		},
+		{
+			name:       "smaller limit",
+			ranges:     []RegisterRange{{200, 261}},
+			maxPerRead: 30, maxGap: 16,
+			want: []RegisterRange{{200, 229}, {230, 259}, {260, 261}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := planReads(tt.ranges, tt.maxPerRead, tt.maxGap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("planReads(%v, %d, %d) = %v, want %v", tt.ranges, tt.maxPerRead, tt.maxGap, got, tt.want)
+			}
+			for _, r := range got {
+				if r.Len() > tt.maxPerRead {
+					t.Errorf("request %v reads %d registers, more than %d", r, r.Len(), tt.maxPerRead)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanReadsErrors(t *testing.T) {
+	tests := []struct {
+		ranges     []RegisterRange
+		maxPerRead int
+	}{
+		{[]RegisterRange{{200, 210}}, 0},
+		{[]RegisterRange{{200, 210}}, 126},
+		{[]RegisterRange{{210, 200}}, 125},
+	}
+	for _, tt := range tests {
+		if got, err := planReads(tt.ranges, tt.maxPerRead, 16); err == nil {
+			t.Errorf("planReads(%v, %d, 16) = %v, want an error", tt.ranges, tt.maxPerRead, got)
+		}
+	}
+}
+
+func TestMergeRanges(t *testing.T) {
+	tests := []struct {
+		ranges []RegisterRange
+		want   []RegisterRange
+	}{
+		{nil, nil},
+		{[]RegisterRange{{10, 20}, {21, 30}}, []RegisterRange{{10, 30}}},
+		{[]RegisterRange{{10, 20}, {15, 25}}, []RegisterRange{{10, 25}}},
+		{[]RegisterRange{{10, 30}, {15, 20}}, []RegisterRange{{10, 30}}},
+		{[]RegisterRange{{30, 40}, {10, 20}}, []RegisterRange{{10, 20}, {30, 40}}},
+		{[]RegisterRange{{10, 20}, {22, 30}}, []RegisterRange{{10, 20}, {22, 30}}},
+		{[]RegisterRange{{5, 5}, {5, 5}}, []RegisterRange{{5, 5}}},
+	}
+	for _, tt := range tests {
+		got, err := mergeRanges(tt.ranges)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("mergeRanges(%v) = %v, want %v", tt.ranges, got, tt.want)
+		}
+	}
+}
+
+func TestInRanges(t *testing.T) {
+	ranges := []RegisterRange{{10, 20}, {30, 40}}
+	tests := []struct {
+		reg  Register
+		want bool
+	}{
+		{9, false},
+		{10, true},
+		{20, true},
+		{25, false},
+		{30, true},
+		{40, true},
+		{41, false},
+	}
+	for _, tt := range tests {
+		if got := inRanges(ranges, tt.reg); got != tt.want {
+			t.Errorf("inRanges(%v, %d) = %t, want %t", ranges, tt.reg, got, tt.want)
+		}
+	}
+	if inRanges(nil, 10) {
+		t.Errorf("inRanges(nil, 10) = true, want false")
+	}
+}
@@ -0,0 +1,95 @@
+package cx34_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sodabrew/chilctl/cx34"
+	"github.com/sodabrew/chilctl/cx34/cx34test"
+)
+
+func TestReadsFollowPlan(t *testing.T) {
+	setpoints := cx34.RegisterRange{First: 140, Last: 144}
+	near := cx34.RegisterRange{First: 150, Last: 152}
+	tests := []struct {
+		name   string
+		params *cx34.Params
+		read   func(c *cx34.Client) (*cx34.State, error)
+		want   string
+		// sparse is set if registers 145-149 are not requested.
+		sparse bool
+	}{
+		{
+			name: "all registers by default",
+			read: func(c *cx34.Client) (*cx34.State, error) { return c.ReadState() },
+			want: "[1-120 121-240 241-350]",
+		},
+		{
+			name:   "all registers, 100 per read",
+			params: &cx34.Params{MaxRegistersPerRead: 100},
+			read:   func(c *cx34.Client) (*cx34.State, error) { return c.ReadState() },
+			want:   "[1-100 101-200 201-300 301-350]",
+		},
+		{
+			name:   "groups joined across a gap",
+			params: &cx34.Params{MaxReadGap: 60},
+			read: func(c *cx34.Client) (*cx34.State, error) {
+				return c.ReadState(cx34.WithGroups(cx34.Setpoints, cx34.Sensors))
+			},
+			want: "[140-259 260-284]",
+		},
+		{
+			name:   "groups too far apart for one read",
+			params: &cx34.Params{MaxRegistersPerRead: 50, MaxReadGap: 60},
+			read: func(c *cx34.Client) (*cx34.State, error) {
+				return c.ReadState(cx34.WithGroups(cx34.Setpoints, cx34.Sensors))
+			},
+			want: "[140-144 200-249 250-284]",
+		},
+		{
+			name:   "ranges joined by the default gap",
+			read:   func(c *cx34.Client) (*cx34.State, error) { return c.ReadRegisters(near, setpoints) },
+			want:   "[140-152]",
+			sparse: true,
+		},
+		{
+			name:   "gap equal to the maximum",
+			params: &cx34.Params{MaxReadGap: 5},
+			read:   func(c *cx34.Client) (*cx34.State, error) { return c.ReadRegisters(setpoints, near) },
+			want:   "[140-152]",
+			sparse: true,
+		},
+		{
+			name:   "gap longer than the maximum",
+			params: &cx34.Params{MaxReadGap: 4},
+			read:   func(c *cx34.Client) (*cx34.State, error) { return c.ReadRegisters(setpoints, near) },
+			want:   "[140-144 150-152]",
+			sparse: true,
+		},
+		{
+			name:   "gaps never read",
+			params: &cx34.Params{MaxReadGap: -1},
+			read:   func(c *cx34.Client) (*cx34.State, error) { return c.ReadRegisters(setpoints, near) },
+			want:   "[140-144 150-152]",
+			sparse: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := cx34test.MustLoadFixture("heating").Transport()
+			s, err := tt.read(cx34.NewClient(tr, tt.params))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(tr.Reads()); got != tt.want {
+				t.Errorf("reads = %s, want %s", got, tt.want)
+			}
+			// Registers read only to fill a gap are left out of the State.
+			for reg := range s.RegisterValues() {
+				if tt.sparse && reg > 144 && reg < 150 {
+					t.Errorf("State holds register %d, which was not requested", uint16(reg))
+				}
+			}
+		})
+	}
+}
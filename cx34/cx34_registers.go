@@ -20,13 +20,35 @@ var (
 
 // This file is used to assign names to modbus registers.
 
+// Value returns the value of reg in the unit given by its RegisterInfo, and
+// whether the state holds it.
+func (s *State) Value(reg Register) (float64, bool) {
+	raw, ok := s.registerValues[reg]
+	if !ok {
+		return 0, false
+	}
+	return DecodeRegister(reg, raw), true
+}
+
+// value is like Value, but returns 0 for registers the state does not hold.
+func (s *State) value(reg Register) float64 {
+	v, _ := s.Value(reg)
+	return v
+}
+
+// temperature returns the value of a temperature register. Registers that
+// can go below zero hold two's-complement values, and are marked Signed in
+// registerTable.
+func (s *State) temperature(reg Register) units.Temperature {
+	return units.FromCelsius(s.value(reg))
+}
+
 // FlowRate returns the water flow rate measured by the CX34's flow sensor.
 //
 // The flow sensor is made by the same company that makes this one:
 // https://www.adafruit.com/product/828?gclid=Cj0KCQiAlZH_BRCgARIsAAZHSBmfM9AVkdnye4p7RVf_cbKDm6n6jILBT9ILjkvpg8PnLjz_38tU324aAsk0EALw_wcB
 func (s *State) FlowRate() units.FlowRate {
-	decilitersPerMinute := s.registerValues[WaterFlowRate]
-	return units.LiterPerMinute.Scale(float64(decilitersPerMinute) / 10.0)
+	return units.LiterPerMinute.Scale(s.value(WaterFlowRate))
 }
 
 // SuctionTemp returns the "suction temperature" of the unit.
@@ -34,52 +56,78 @@ func (s *State) FlowRate() units.FlowRate {
 // A typical value in heating mode is 3.3 degrees C, so I'm not sure what this
 // measures exactly.
 func (s *State) SuctionTemp() units.Temperature {
-	deciDegreesC := s.registerValues[SuctionTemp]
-	return units.FromCelsius(float64(deciDegreesC) / 10.0)
+	return s.temperature(SuctionTemp)
 }
 
 // ACCoolingTargetTemp returns the cooling setpoint temperature.
 func (s *State) ACCoolingTargetTemp() units.Temperature {
-	degreesC := s.registerValues[TargetACCoolingModeTemp]
-	return units.FromCelsius(float64(degreesC))
+	return s.temperature(TargetACCoolingModeTemp)
 }
 
 // ACHeatingTargetTemp returns the heating setpoint temperature.
 func (s *State) ACHeatingTargetTemp() units.Temperature {
-	degreesC := s.registerValues[TargetACHeatingModeTemp]
-	return units.FromCelsius(float64(degreesC))
+	return s.temperature(TargetACHeatingModeTemp)
 }
 
 // DomesticHotWaterTargetTemp returns the DHW setpoint temperature.
 func (s *State) DomesticHotWaterTargetTemp() units.Temperature {
-	degreesC := s.registerValues[TargetDomesticHotWaterTemp]
-	return units.FromCelsius(float64(degreesC))
+	return s.temperature(TargetDomesticHotWaterTemp)
 }
 
 // ACOutletWaterTemp returns the temperature at the water outlet; values are -30~97℃.
 func (s *State) ACOutletWaterTemp() units.Temperature {
-	deciDegreesC := s.registerValues[ACOutletWaterTemp]
-	return units.FromCelsius(float64(deciDegreesC) / 10.0)
+	return s.temperature(ACOutletWaterTemp)
 }
 
 // ACInletWaterTemp returns the temperature at the water inlet; values are -30~97℃.
 func (s *State) ACInletWaterTemp() units.Temperature {
-	deciDegreesC := s.registerValues[WaterInletSensorTemp1]
-	return units.FromCelsius(float64(deciDegreesC) / 10.0)
+	return s.temperature(WaterInletSensorTemp1)
 }
 
 // AmbientTemp returns the temperature reported by the CX34's ambient
 // temperature sensor.
 func (s *State) AmbientTemp() units.Temperature {
-	deciDegreesC := s.registerValues[AmbientTemp]
-	return units.FromCelsius(float64(deciDegreesC) / 10.0)
+	return s.temperature(AmbientTemp)
+}
+
+// OutPipeTemp returns the temperature of the outdoor coil pipe; values are -30~97℃.
+func (s *State) OutPipeTemp() units.Temperature {
+	return s.temperature(OutPipeTemp)
+}
+
+// CompressorDischargeTemp returns the temperature of the refrigerant leaving
+// the compressor.
+func (s *State) CompressorDischargeTemp() units.Temperature {
+	return s.temperature(CompressorDischargeTemp)
+}
+
+// PlateHeatExchangerTemp returns the temperature of the plate heat exchanger
+// between the refrigerant and the water loop.
+func (s *State) PlateHeatExchangerTemp() units.Temperature {
+	return s.temperature(PlateHeatExchangerTemp)
+}
+
+// OutdoorModularTemp returns the temperature of the outdoor module; values
+// are -30~97℃.
+func (s *State) OutdoorModularTemp() units.Temperature {
+	return s.temperature(OutdoorModularTemp)
+}
+
+// InnerPipeTemp returns the temperature of the indoor coil pipe; values are
+// -30~97℃.
+func (s *State) InnerPipeTemp() units.Temperature {
+	return s.temperature(InnerPipeTemp)
+}
+
+// IPMTemp returns the temperature of the compressor driver's power module.
+func (s *State) IPMTemp() units.Temperature {
+	return s.temperature(IPMTemp)
 }
 
 // DomesticHotWaterTankTemp returns the temperature reported by the CX34's temperature
 // sensor on the hot water tank, if connected.
 func (s *State) DomesticHotWaterTankTemp() units.Temperature {
-	deciDegreesC := s.registerValues[DomesticHotWaterTankTemp]
-	return units.FromCelsius(float64(deciDegreesC) / 10.0)
+	return s.temperature(DomesticHotWaterTankTemp)
 }
 
 // InternalPumpSpeed returns the power setting of the variable-speed water pump inside
@@ -96,12 +144,12 @@ func (s *State) BoosterPumpSpeed() units.PumpSpeed {
 
 // ACVoltage returns the measured input AC Voltage value.
 func (s *State) ACVoltage() units.Voltage {
-	return units.Volt * units.Voltage(s.registerValues[InputACVoltage])
+	return units.Volt * units.Voltage(s.value(InputACVoltage))
 }
 
 // ACCurrent returns the measured input AC Current value.
 func (s *State) ACCurrent() units.Current {
-	return units.Ampere * units.Current(s.registerValues[InputACCurrent]) / 10.0
+	return units.Ampere * units.Current(s.value(InputACCurrent))
 }
 
 // ApparentPower returns the measured input AC Current times the measured AC
@@ -116,12 +164,12 @@ func (s *State) ApparentPower() units.Power {
 
 // CompressorCurrent returns the "Compressor phase current value".
 func (s *State) CompressorCurrent() units.Current {
-	return units.Ampere * units.Current(s.registerValues[CompressorPhaseCurrent]) / 10.0
+	return units.Ampere * units.Current(s.value(CompressorPhaseCurrent))
 }
 
 // InductorACCurrent returns the "inductor AC current value P15".
 func (s *State) InductorACCurrent() units.Current {
-	return units.Ampere * units.Current(s.registerValues[InductorACCurrent]) / 10.0
+	return units.Ampere * units.Current(s.value(InductorACCurrent))
 }
 
 // UsefulHeatRate returns the amount of useful heat added or removed from the
@@ -180,7 +228,7 @@ func (s *State) ACMode() AirConditioningMode {
 	raw := s.registerValues[ACMode]
 	mode, err := parseAirConditioningMode(raw)
 	if err != nil {
-		glog.Errorf("error parsing AC mode - should add %d to the enum definition to fix: %w", raw, err)
+		glog.Errorf("error parsing AC mode - should add %d to the enum definition to fix: %v", raw, err)
 	}
 	return mode
 }
@@ -211,7 +259,7 @@ func parseAirConditioningMode(val uint16) (AirConditioningMode, error) {
 	if _, ok := validACModes[asEnum]; ok {
 		return asEnum, nil
 	}
-	return asEnum, fmt.Errorf("invalid ACMode value %d")
+	return asEnum, fmt.Errorf("invalid ACMode value %d", val)
 }
 
 func (m AirConditioningMode) String() string {
@@ -281,16 +329,15 @@ Table of registers with values that changed
 | 282          | C82                         | 399   |
 */
 
-// Known Register values.
+// Known Register values. See registerTable for what each of them holds.
 const (
-	OnOffMode                             Register = 140 // 0 = off (standby), 1 = on
-	ACMode                                Register = 141 // 0 = cool, 1 = heat
-	TargetACCoolingModeTemp               Register = 142
-	TargetACHeatingModeTemp               Register = 143
-	TargetDomesticHotWaterTemp            Register = 144
-	// See page 47-48 of https://www.chiltrix.com/documents/CX34-IOM-3.pdf
-	ECWaterPumpMinimumSpeed               Register = 53 // 40-80 (corresponding to 40%-80%): Minimum electronically commutated water pump speed.
-	// See page 51 of https://www.chiltrix.com/documents/CX34-IOM-3.pdf
+	OnOffMode                  Register = 140
+	ACMode                     Register = 141
+	TargetACCoolingModeTemp    Register = 142
+	TargetACHeatingModeTemp    Register = 143
+	TargetDomesticHotWaterTemp Register = 144
+	ECWaterPumpMinimumSpeed    Register = 53
+
 	OutPipeTemp                           Register = 200
 	CompressorDischargeTemp               Register = 201
 	AmbientTemp                           Register = 202
@@ -298,133 +345,159 @@ const (
 	PlateHeatExchangerTemp                Register = 204
 	ACOutletWaterTemp                     Register = 205
 	SolarTemp                             Register = 206
-	CompressorCurrentValueP15             Register = 209 // 0.00-30.0A
-	WaterFlowRate                         Register = 213 // tenths of a liter per minute
+	CompressorCurrentValueP15             Register = 209
+	WaterFlowRate                         Register = 213
 	P03Status                             Register = 214
 	P04Status                             Register = 215
 	P05Status                             Register = 216
 	P06Status                             Register = 217
 	P07Status                             Register = 218
-	P08Status                             Register = 219 // 0=DHW valid, 1=DHW invalid
-	P09Status                             Register = 220 // 0=Heating valid, 1=Heating invalid
-	P10Status                             Register = 221 // 0=Cooling valid, 1=Cooling invalid
-	HighPressureSwitchStatus              Register = 222 // 1=on, 0=off
-	LowPressureSwitchStatus               Register = 223 // 1=on, 0=off
-	SecondHighPressureSwitchStatus        Register = 224 // 1=on, 0=off
-	InnerWaterFlowSwitch                  Register = 225 // 1=on, 0=off
-	CompressorFrequency                   Register = 227 // Displays the actual operating frequency
-	ThermalSwitchStatus                   Register = 228 // 1=on, 0=off
-	OutdoorFanMotor                       Register = 229 // 1=on, 0=off
-	ElectricalValve1                      Register = 230 // 1=run, 0=stop
-	ElectricalValve2                      Register = 231 // 1=run, 0=stop
-	ElectricalValve3                      Register = 232 // 1=run, 0=stop
-	ElectricalValve4                      Register = 233 // 1=run, 0=stop
-	C4WaterPump                           Register = 234 // 1=run, 0=stop
-	C5WaterPump                           Register = 235 // 1=run, 0=stop
-	C6waterPump                           Register = 236 // 1=run, 0=stop
-	AccumulativeDaysAFterLastVirusKilling Register = 237 // Days since last virus killing 0-99
-	OutdoorModularTemp                    Register = 238 // -30~97 celsius
-	ExpansionValve1OpeningDegree          Register = 239 // 0~500
-	ExpansionValve2OpeningDegree          Register = 240 // 0~500
-	InnerPipeTemp                         Register = 241 // -30~97 celsius
-	HeatingMethod2TargetTemperature       Register = 242 // -30~97 celsius
-	IndoorTemperatureControlSwitch        Register = 243 // 1=on, 0=off
-	FanType                               Register = 244 // 0=AC fan, 1=EC fan 1, 2=EC fan 2
-	ECFanMotor1Speed                      Register = 245 // 0~3000 0~3000
-	ECFanMotor2Speed                      Register = 246 // 0~3000 0~3000
-	WaterPumpTypes                        Register = 247 // 0=AC Water pump, 1=EC Water pump
-	InternalPumpSpeed                     Register = 248 // (C4) 1~10 (10 means 100%)
-	BoosterPumpSpeed                      Register = 249 // 1~10 (10 means 100%)
-	InductorACCurrent                     Register = 250 // 0~50A
-	DriverWorkingStatusValue              Register = 251 // Hexadecimal value
-	CompressorShutDownCode                Register = 252 // Hexadecimal value
-	DriverAllowedHighestFrequency         Register = 253 // 30-120Hz
-	ReduceFrequencyTemperature            Register = 254 // setting 55~200 celsius
-	InputACVoltage                        Register = 255 // 0~550V
-	InputACCurrent                        Register = 256 // 0~50A（IPM test)
-	CompressorPhaseCurrent                Register = 257 // 0~50A（IPM test）
-	BusLineVoltage                        Register = 258 // 0~750V 0~750V
-	FanShutdownCode                       Register = 259 // Hexadecimal value
-	IPMTemp                               Register = 260 // 55~200 celsius
-	CompressorTotalRunningTime            Register = 261 // Hours since last power cycle 0~65000
-
-	// Inferred values.
-	DomesticHotWaterTankTemp              Register = 280
-	WaterInletSensorTemp1                 Register = 281
-	WaterInletSensorTemp2                 Register = 282
-	CurrentFaultCode                      Register = 284 // Set to 32 when I get a P5 error, not sure about other faults.
+	P08Status                             Register = 219
+	P09Status                             Register = 220
+	P10Status                             Register = 221
+	HighPressureSwitchStatus              Register = 222
+	LowPressureSwitchStatus               Register = 223
+	SecondHighPressureSwitchStatus        Register = 224
+	InnerWaterFlowSwitch                  Register = 225
+	CompressorFrequency                   Register = 227
+	ThermalSwitchStatus                   Register = 228
+	OutdoorFanMotor                       Register = 229
+	ElectricalValve1                      Register = 230
+	ElectricalValve2                      Register = 231
+	ElectricalValve3                      Register = 232
+	ElectricalValve4                      Register = 233
+	C4WaterPump                           Register = 234
+	C5WaterPump                           Register = 235
+	C6waterPump                           Register = 236
+	AccumulativeDaysAFterLastVirusKilling Register = 237
+	OutdoorModularTemp                    Register = 238
+	ExpansionValve1OpeningDegree          Register = 239
+	ExpansionValve2OpeningDegree          Register = 240
+	InnerPipeTemp                         Register = 241
+	HeatingMethod2TargetTemperature       Register = 242
+	IndoorTemperatureControlSwitch        Register = 243
+	FanType                               Register = 244
+	ECFanMotor1Speed                      Register = 245
+	ECFanMotor2Speed                      Register = 246
+	WaterPumpTypes                        Register = 247
+	InternalPumpSpeed                     Register = 248
+	BoosterPumpSpeed                      Register = 249
+	InductorACCurrent                     Register = 250
+	DriverWorkingStatusValue              Register = 251
+	CompressorShutDownCode                Register = 252
+	DriverAllowedHighestFrequency         Register = 253
+	ReduceFrequencyTemperature            Register = 254
+	InputACVoltage                        Register = 255
+	InputACCurrent                        Register = 256
+	CompressorPhaseCurrent                Register = 257
+	BusLineVoltage                        Register = 258
+	FanShutdownCode                       Register = 259
+	IPMTemp                               Register = 260
+	CompressorTotalRunningTime            Register = 261
+
+	DomesticHotWaterTankTemp Register = 280
+	WaterInletSensorTemp1    Register = 281
+	WaterInletSensorTemp2    Register = 282
+	CurrentFaultCode         Register = 284
+)
+
+// Sources of register information.
+const (
+	sourceBACnetGuide = "https://www.chiltrix.com/control-options/Remote-Gateway-BACnet-Guide-rev2.pdf"
+	sourceIOMSettings = "https://www.chiltrix.com/documents/CX34-IOM-3.pdf, pages 47-48"
+	sourceIOMDetails  = "https://www.chiltrix.com/documents/CX34-IOM-3.pdf, page 51"
+	sourceObserved    = "inferred from a running unit"
 )
 
-// Source: https://www.chiltrix.com/control-options/Remote-Gateway-BACnet-Guide-rev2.pdf
-var registerNames = map[Register]string{
-	OnOffMode:                             "OnOffMode",
-	ACMode:                                "ACMode",
-	TargetACCoolingModeTemp:               "TargetACCoolingModeTemp",
-	TargetACHeatingModeTemp:               "TargetACHeatingModeTemp",
-	TargetDomesticHotWaterTemp:            "TargetDomesticHotWaterTemp",            // was: "Din7 AC Cooling Mode Switch",
+// Templates for common kinds of register.
+var (
+	// Temperatures in tenths of a degree, negative below zero.
+	deciCelsius = RegisterInfo{Scale: 0.1, Unit: "°C", Signed: true, Min: -30, Max: 97}
+	onOff       = RegisterInfo{Min: 0, Max: 1}
+)
+
+// with returns a copy of the template with the given identity.
+func (info RegisterInfo) with(reg Register, name, description, source string) RegisterInfo {
+	info.Register, info.Name, info.Description, info.Source = reg, name, description, source
+	return info
+}
+
+// registerTable holds everything known about the holding registers. To
+// support a new register, add a constant for it and an entry here.
+var registerTable = []RegisterInfo{
+	{Register: ECWaterPumpMinimumSpeed, Name: "ECWaterPumpMinimumSpeed", Unit: "%", Min: 40, Max: 80, Description: "Minimum speed of the electronically commutated water pump", Source: sourceIOMSettings},
+
+	{Register: OnOffMode, Name: "OnOffMode", Min: 0, Max: 1, Writable: true, Description: "0 = off (standby), 1 = on", Source: sourceBACnetGuide},
+	{Register: ACMode, Name: "ACMode", Min: 0, Max: 4, Writable: true, Description: "0 = cooling, 1 = heating, 2 = DHW only, 3 = cooling + DHW, 4 = heating + DHW", Source: sourceBACnetGuide},
+	{Register: TargetACCoolingModeTemp, Name: "TargetACCoolingModeTemp", Unit: "°C", Min: 5, Max: 70, Writable: true, Description: "Cooling setpoint", Source: sourceBACnetGuide},
+	{Register: TargetACHeatingModeTemp, Name: "TargetACHeatingModeTemp", Unit: "°C", Min: 5, Max: 70, Writable: true, Description: "Heating setpoint", Source: sourceBACnetGuide},
+	// Was named "Din7 AC Cooling Mode Switch".
+	{Register: TargetDomesticHotWaterTemp, Name: "TargetDomesticHotWaterTemp", Unit: "°C", Min: 5, Max: 70, Writable: true, Description: "Domestic hot water setpoint", Source: sourceBACnetGuide},
+
 	// Starting at 200, it's all the C parameters from the details screen.
-	DomesticHotWaterTankTemp:              "DomesticHotWaterTankTemp",
-	WaterInletSensorTemp1:                 "WaterInletSensorTemp1",
-	WaterInletSensorTemp2:                 "WaterInletSensorTemp2",
-
-	// P0-... registers.
-	ECWaterPumpMinimumSpeed:               "ECWaterPumpMinimumSpeed",
-
-	OutPipeTemp:                           "OutPipeTemp",
-	CompressorDischargeTemp:               "CompressorDischargeTemp",
-	AmbientTemp:                           "AmbientTemp",
-	SuctionTemp:                           "SuctionTemp",
-	PlateHeatExchangerTemp:                "PlateHeatExchangerTemp",
-	ACOutletWaterTemp:                     "ACOutletWaterTemp",
-	SolarTemp:                             "SolarTemp",
-	CompressorCurrentValueP15:             "CompressorCurrentValueP15",             // 0.00-30.0A
-	WaterFlowRate:                         "WaterFlowRate",                         // tenths of a liter per minute
-	P03Status:                             "P03Status",
-	P04Status:                             "P04Status",
-	P05Status:                             "P05Status",
-	P06Status:                             "P06Status",
-	P07Status:                             "P07Status",
-	P08Status:                             "P08Status",                             // 0=DHW valid, 1=DHW invalid
-	P09Status:                             "P09Status",                             // 0=Heating valid, 1=Heating invalid
-	P10Status:                             "P10Status",                             // 0=Cooling valid, 1=Cooling invalid
-	HighPressureSwitchStatus:              "HighPressureSwitchStatus",              // 1=on, 0=off
-	LowPressureSwitchStatus:               "LowPressureSwitchStatus",               // 1=on, 0=off
-	SecondHighPressureSwitchStatus:        "SecondHighPressureSwitchStatus",        // 1=on, 0=off
-	InnerWaterFlowSwitch:                  "InnerWaterFlowSwitch",                  // 1=on, 0=off
-	CompressorFrequency:                   "CompressorFrequency",                   // Displays the actual operating frequency
-	ThermalSwitchStatus:                   "ThermalSwitchStatus",                   // 1=on, 0=off
-	OutdoorFanMotor:                       "OutdoorFanMotor",                       // 1=on, 0=off
-	ElectricalValve1:                      "ElectricalValve1",                      // 1=run, 0=stop
-	ElectricalValve2:                      "ElectricalValve2",                      // 1=run, 0=stop
-	ElectricalValve3:                      "ElectricalValve3",                      // 1=run, 0=stop
-	ElectricalValve4:                      "ElectricalValve4",                      // 1=run, 0=stop
-	C4WaterPump:                           "C4WaterPump",                           // 1=run, 0=stop
-	C5WaterPump:                           "C5WaterPump",                           // 1=run, 0=stop
-	C6waterPump:                           "C6waterPump",                           // 1=run, 0=stop
-	AccumulativeDaysAFterLastVirusKilling: "AccumulativeDaysAFterLastVirusKilling", // Days since last virus killing 0-99
-	OutdoorModularTemp:                    "OutdoorModularTemp",                    // -30~97 celsius
-	ExpansionValve1OpeningDegree:          "ExpansionValve1OpeningDegree",          // 0~500
-	ExpansionValve2OpeningDegree:          "ExpansionValve2OpeningDegree",          // 0~500
-	InnerPipeTemp:                         "InnerPipeTemp",                         // -30~97 celsius
-	HeatingMethod2TargetTemperature:       "HeatingMethod2TargetTemperature",       // -30~97 celsius
-	IndoorTemperatureControlSwitch:        "IndoorTemperatureControlSwitch",        // 1=on, 0=off
-	FanType:                               "FanType",                               // 0= AC fan, 1=EC fan 1, 2=EC fan 2
-	ECFanMotor1Speed:                      "ECFanMotor1Speed",                      // 0~3000
-	ECFanMotor2Speed:                      "ECFanMotor2Speed",                      // 0~3000
-	WaterPumpTypes:                        "WaterPumpTypes",                        // 0=AC Water pump, 1=EC Water pump
-	InternalPumpSpeed:                     "InternalPumpSpeed",                     // (C4) 1~10 (10 means 100%)
-	BoosterPumpSpeed:                      "BoosterPumpSpeed",                      // 1~10 (10 means 100%)
-	InductorACCurrent:                     "InductorACCurrent",                     // 0~50A
-	DriverWorkingStatusValue:              "DriverWorkingStatusValue",              // Hexadecimal value
-	CompressorShutDownCode:                "CompressorShutDownCode",                // Hexadecimal value
-	DriverAllowedHighestFrequency:         "DriverAllowedHighestFrequency",         // 30-120Hz
-	ReduceFrequencyTemperature:            "ReduceFrequencyTemperature",            // setting 55~200 celsius
-	InputACVoltage:                        "InputACVoltage",                        // 0~550V
-	InputACCurrent:                        "InputACCurrent",                        // 0~50A（IPM test)
-	CompressorPhaseCurrent:                "CompressorPhaseCurrent",                // 0~50A（IPM test)
-	BusLineVoltage:                        "BusLineVoltage",                        // 0~750V
-	FanShutdownCode:                       "FanShutdownCode",                       // Hexadecimal value
-	IPMTemp:                               "IPMTemp",                               // 55~200 celsius
-	CompressorTotalRunningTime:            "CompressorTotalRunningTime",            // Hours since last power cycle 0~65000
-	CurrentFaultCode:                      "Fault Code?",                           // Set to 32 when I get a P5 error code.
+	deciCelsius.with(OutPipeTemp, "OutPipeTemp", "Outdoor coil pipe temperature (C0)", sourceIOMDetails),
+	// Discharge temperatures go well above the -30~97℃ of the other sensors,
+	// and the manual gives no range.
+	{Register: CompressorDischargeTemp, Name: "CompressorDischargeTemp", Scale: 0.1, Unit: "°C", Signed: true, Description: "Compressor discharge temperature (C1)", Source: sourceIOMDetails},
+	deciCelsius.with(AmbientTemp, "AmbientTemp", "Outdoor ambient temperature (C2)", sourceIOMDetails),
+	deciCelsius.with(SuctionTemp, "SuctionTemp", "Compressor suction temperature (C3)", sourceIOMDetails),
+	deciCelsius.with(PlateHeatExchangerTemp, "PlateHeatExchangerTemp", "Plate heat exchanger temperature (C4)", sourceIOMDetails),
+	deciCelsius.with(ACOutletWaterTemp, "ACOutletWaterTemp", "Water outlet temperature (C5)", sourceIOMDetails),
+	deciCelsius.with(SolarTemp, "SolarTemp", "Solar temperature (C6)", sourceIOMDetails),
+	{Register: CompressorCurrentValueP15, Name: "CompressorCurrentValueP15", Scale: 0.1, Unit: "A", Min: 0, Max: 30, Description: "Compressor current (C9)", Source: sourceIOMDetails},
+	{Register: WaterFlowRate, Name: "WaterFlowRate", Scale: 0.1, Unit: "l/min", Description: "Water flow rate (C13)", Source: sourceIOMDetails},
+	onOff.with(P03Status, "P03Status", "", sourceIOMDetails),
+	onOff.with(P04Status, "P04Status", "", sourceIOMDetails),
+	onOff.with(P05Status, "P05Status", "", sourceIOMDetails),
+	onOff.with(P06Status, "P06Status", "", sourceIOMDetails),
+	onOff.with(P07Status, "P07Status", "", sourceIOMDetails),
+	onOff.with(P08Status, "P08Status", "0 = DHW valid, 1 = DHW invalid", sourceIOMDetails),
+	onOff.with(P09Status, "P09Status", "0 = heating valid, 1 = heating invalid", sourceIOMDetails),
+	onOff.with(P10Status, "P10Status", "0 = cooling valid, 1 = cooling invalid", sourceIOMDetails),
+	onOff.with(HighPressureSwitchStatus, "HighPressureSwitchStatus", "1 = on, 0 = off", sourceIOMDetails),
+	onOff.with(LowPressureSwitchStatus, "LowPressureSwitchStatus", "1 = on, 0 = off", sourceIOMDetails),
+	onOff.with(SecondHighPressureSwitchStatus, "SecondHighPressureSwitchStatus", "1 = on, 0 = off", sourceIOMDetails),
+	onOff.with(InnerWaterFlowSwitch, "InnerWaterFlowSwitch", "1 = on, 0 = off", sourceIOMDetails),
+	{Register: CompressorFrequency, Name: "CompressorFrequency", Unit: "Hz", Description: "Actual operating frequency of the compressor", Source: sourceIOMDetails},
+	onOff.with(ThermalSwitchStatus, "ThermalSwitchStatus", "1 = on, 0 = off", sourceIOMDetails),
+	onOff.with(OutdoorFanMotor, "OutdoorFanMotor", "1 = on, 0 = off", sourceIOMDetails),
+	onOff.with(ElectricalValve1, "ElectricalValve1", "1 = run, 0 = stop", sourceIOMDetails),
+	onOff.with(ElectricalValve2, "ElectricalValve2", "1 = run, 0 = stop", sourceIOMDetails),
+	onOff.with(ElectricalValve3, "ElectricalValve3", "1 = run, 0 = stop", sourceIOMDetails),
+	onOff.with(ElectricalValve4, "ElectricalValve4", "1 = run, 0 = stop", sourceIOMDetails),
+	onOff.with(C4WaterPump, "C4WaterPump", "1 = run, 0 = stop", sourceIOMDetails),
+	onOff.with(C5WaterPump, "C5WaterPump", "1 = run, 0 = stop", sourceIOMDetails),
+	onOff.with(C6waterPump, "C6waterPump", "1 = run, 0 = stop", sourceIOMDetails),
+	{Register: AccumulativeDaysAFterLastVirusKilling, Name: "AccumulativeDaysAFterLastVirusKilling", Unit: "d", Min: 0, Max: 99, Description: "Days since the last anti-legionella cycle", Source: sourceIOMDetails},
+	deciCelsius.with(OutdoorModularTemp, "OutdoorModularTemp", "Outdoor module temperature", sourceIOMDetails),
+	{Register: ExpansionValve1OpeningDegree, Name: "ExpansionValve1OpeningDegree", Min: 0, Max: 500, Description: "Opening of electronic expansion valve 1, in steps", Source: sourceIOMDetails},
+	{Register: ExpansionValve2OpeningDegree, Name: "ExpansionValve2OpeningDegree", Min: 0, Max: 500, Description: "Opening of electronic expansion valve 2, in steps", Source: sourceIOMDetails},
+	deciCelsius.with(InnerPipeTemp, "InnerPipeTemp", "Indoor coil pipe temperature", sourceIOMDetails),
+	deciCelsius.with(HeatingMethod2TargetTemperature, "HeatingMethod2TargetTemperature", "Target temperature of heating method 2", sourceIOMDetails),
+	onOff.with(IndoorTemperatureControlSwitch, "IndoorTemperatureControlSwitch", "1 = on, 0 = off", sourceIOMDetails),
+	{Register: FanType, Name: "FanType", Min: 0, Max: 2, Description: "0 = AC fan, 1 = EC fan 1, 2 = EC fan 2", Source: sourceIOMDetails},
+	{Register: ECFanMotor1Speed, Name: "ECFanMotor1Speed", Unit: "rpm", Min: 0, Max: 3000, Description: "Speed of EC fan motor 1", Source: sourceIOMDetails},
+	{Register: ECFanMotor2Speed, Name: "ECFanMotor2Speed", Unit: "rpm", Min: 0, Max: 3000, Description: "Speed of EC fan motor 2", Source: sourceIOMDetails},
+	{Register: WaterPumpTypes, Name: "WaterPumpTypes", Min: 0, Max: 1, Description: "0 = AC water pump, 1 = EC water pump", Source: sourceIOMDetails},
+	{Register: InternalPumpSpeed, Name: "InternalPumpSpeed", Min: 1, Max: 10, Description: "Speed of the internal water pump (C4), 10 means 100%", Source: sourceIOMDetails},
+	{Register: BoosterPumpSpeed, Name: "BoosterPumpSpeed", Min: 1, Max: 10, Description: "Speed of the booster water pump, 10 means 100%", Source: sourceIOMDetails},
+	{Register: InductorACCurrent, Name: "InductorACCurrent", Scale: 0.1, Unit: "A", Min: 0, Max: 50, Description: "Inductor AC current (P15)", Source: sourceIOMDetails},
+	{Register: DriverWorkingStatusValue, Name: "DriverWorkingStatusValue", Hex: true, Description: "Compressor driver status", Source: sourceIOMDetails},
+	{Register: CompressorShutDownCode, Name: "CompressorShutDownCode", Hex: true, Description: "Reason the compressor last shut down", Source: sourceIOMDetails},
+	{Register: DriverAllowedHighestFrequency, Name: "DriverAllowedHighestFrequency", Unit: "Hz", Min: 30, Max: 120, Description: "Highest compressor frequency allowed by the driver", Source: sourceIOMDetails},
+	{Register: ReduceFrequencyTemperature, Name: "ReduceFrequencyTemperature", Unit: "°C", Min: 55, Max: 200, Description: "Driver temperature above which the compressor frequency is reduced", Source: sourceIOMDetails},
+	{Register: InputACVoltage, Name: "InputACVoltage", Unit: "V", Min: 0, Max: 550, Description: "Input AC voltage", Source: sourceIOMDetails},
+	{Register: InputACCurrent, Name: "InputACCurrent", Scale: 0.1, Unit: "A", Min: 0, Max: 50, Description: "Input AC current (IPM test)", Source: sourceIOMDetails},
+	{Register: CompressorPhaseCurrent, Name: "CompressorPhaseCurrent", Scale: 0.1, Unit: "A", Min: 0, Max: 50, Description: "Compressor phase current (IPM test)", Source: sourceIOMDetails},
+	{Register: BusLineVoltage, Name: "BusLineVoltage", Unit: "V", Min: 0, Max: 750, Description: "DC bus voltage of the compressor driver", Source: sourceIOMDetails},
+	{Register: FanShutdownCode, Name: "FanShutdownCode", Hex: true, Description: "Reason the fan last shut down", Source: sourceIOMDetails},
+	// The manual gives 55~200℃, but an idle unit reads the outdoor
+	// temperature, which may be below zero.
+	{Register: IPMTemp, Name: "IPMTemp", Unit: "°C", Signed: true, Description: "Temperature of the compressor driver's power module", Source: sourceIOMDetails},
+	{Register: CompressorTotalRunningTime, Name: "CompressorTotalRunningTime", Unit: "h", Min: 0, Max: 65000, Description: "Compressor running hours since the last power cycle", Source: sourceIOMDetails},
+
+	deciCelsius.with(DomesticHotWaterTankTemp, "DomesticHotWaterTankTemp", "Domestic hot water tank temperature, if a sensor is connected", sourceObserved),
+	deciCelsius.with(WaterInletSensorTemp1, "WaterInletSensorTemp1", "Water inlet temperature", sourceObserved),
+	deciCelsius.with(WaterInletSensorTemp2, "WaterInletSensorTemp2", "Water inlet temperature, second sensor", sourceObserved),
+	{Register: CurrentFaultCode, Name: "CurrentFaultCode", Description: "Current fault; reads 32 during a P5 error, other codes are not known", Source: sourceObserved},
 }
@@ -0,0 +1,78 @@
+package cx34_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sodabrew/chilctl/cx34"
+	"github.com/sodabrew/chilctl/cx34/cx34test"
+	"github.com/sodabrew/chilctl/units"
+)
+
+func TestDecodeRegister(t *testing.T) {
+	tests := []struct {
+		reg  cx34.Register
+		raw  uint16
+		want float64
+	}{
+		{cx34.AmbientTemp, 0xff83, -12.5},
+		{cx34.AmbientTemp, 0xffff, -0.1},
+		{cx34.AmbientTemp, 0xfed4, -30},
+		{cx34.AmbientTemp, 0x0031, 4.9},
+		{cx34.SuctionTemp, 0xff35, -20.3},
+		{cx34.OutdoorModularTemp, 0xff9b, -10.1},
+		{cx34.CompressorDischargeTemp, 0x044c, 110},
+		{cx34.IPMTemp, 0xfffc, -4},
+		{cx34.WaterFlowRate, 0x006e, 11},
+		// Registers that are not signed keep their high values.
+		{cx34.InputACVoltage, 0xffff, 65535},
+		{cx34.TargetACHeatingModeTemp, 39, 39},
+	}
+	for _, tt := range tests {
+		if got := cx34.DecodeRegister(tt.reg, tt.raw); got != tt.want {
+			t.Errorf("DecodeRegister(%v, %#04x) = %v, want %v", tt.reg, tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestFormatRegisterNegative(t *testing.T) {
+	if got, want := cx34.FormatRegister(cx34.AmbientTemp, 0xff83), "-12.5°C"; got != want {
+		t.Errorf("FormatRegister(AmbientTemp, 0xff83) = %q, want %q", got, want)
+	}
+}
+
+func TestStateNegativeTemperatures(t *testing.T) {
+	f := cx34test.MustLoadFixture("cold")
+	if f.Registers[cx34.AmbientTemp]&0xff00 != 0xff00 {
+		t.Fatalf("cold fixture AmbientTemp = %#04x, want a negative raw value", f.Registers[cx34.AmbientTemp])
+	}
+	s := f.State()
+	tests := []struct {
+		name string
+		got  units.Temperature
+		want float64
+	}{
+		{"AmbientTemp", s.AmbientTemp(), -12.5},
+		{"SuctionTemp", s.SuctionTemp(), -20.3},
+		{"OutPipeTemp", s.OutPipeTemp(), -18},
+		{"OutdoorModularTemp", s.OutdoorModularTemp(), -10.1},
+		{"ACOutletWaterTemp", s.ACOutletWaterTemp(), 36.4},
+		{"ACInletWaterTemp", s.ACInletWaterTemp(), 31.8},
+	}
+	for _, tt := range tests {
+		if c := tt.got.Celsius(); math.Abs(c-tt.want) > 1e-9 {
+			t.Errorf("%s() = %v°C, want %v°C", tt.name, c, tt.want)
+		}
+	}
+	if v, ok := s.Value(cx34.AmbientTemp); !ok || v != -12.5 {
+		t.Errorf("Value(AmbientTemp) = %v, %t, want -12.5, true", v, ok)
+	}
+}
+
+func TestTemperatureRegistersSigned(t *testing.T) {
+	for _, info := range cx34.KnownRegisters() {
+		if info.Unit == "°C" && info.Scale == 0.1 && !info.Signed {
+			t.Errorf("%v is a temperature sensor but is not signed", info.Register)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package cx34
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+)
+
+// Replay is a Transport that answers requests from a capture instead of a
+// heat pump, so that problems seen in the field can be reproduced, and tests
+// run, without hardware.
+//
+// Requests must be made in the order they were captured; a request that
+// differs from the next one in the capture fails with ErrReplayMismatch,
+// and is not retried. A captured request without a response fails with
+// ErrTimeout, and a captured response with a bad CRC with ErrCRCMismatch,
+// as they did originally.
+type Replay struct {
+	mu      sync.Mutex
+	frames  []*CapturedFrame
+	next    int
+	handler *replayHandler
+	client  modbus.Client
+}
+
+// NewReplay reads a capture from r and returns a Transport replaying it.
+func NewReplay(r io.Reader) (*Replay, error) {
+	frames, err := NewCaptureReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	replay := &Replay{frames: frames}
+	replay.handler = &replayHandler{replay: replay}
+	replay.client = modbus.NewClient(replay.handler)
+	return replay, nil
+}
+
+// Remaining returns the number of captured requests not yet replayed.
+func (r *Replay) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, f := range r.frames[r.next:] {
+		if f.Direction != DirectionResponse {
+			n++
+		}
+	}
+	return n
+}
+
+// ReadHoldingRegisters implements Transport.
+func (r *Replay) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	return r.do(func() ([]byte, error) {
+		return r.client.ReadHoldingRegisters(address, quantity)
+	})
+}
+
+// WriteSingleRegister implements Transport.
+func (r *Replay) WriteSingleRegister(address, value uint16) ([]byte, error) {
+	return r.do(func() ([]byte, error) {
+		return r.client.WriteSingleRegister(address, value)
+	})
+}
+
+// WriteMultipleRegisters implements Transport.
+func (r *Replay) WriteMultipleRegisters(address, quantity uint16, value []byte) ([]byte, error) {
+	return r.do(func() ([]byte, error) {
+		return r.client.WriteMultipleRegisters(address, quantity, value)
+	})
+}
+
+// do runs op addressed to the unit of the next captured request.
+func (r *Replay) do(op func() ([]byte, error)) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.skipResponses()
+	if r.next < len(r.frames) && len(r.frames[r.next].ADU) > 0 {
+		r.handler.SlaveId = r.frames[r.next].ADU[0]
+	}
+	return op()
+}
+
+// skipResponses skips responses that no replayed request asked for. Caller
+// must hold the mutex.
+func (r *Replay) skipResponses() {
+	for r.next < len(r.frames) && r.frames[r.next].Direction == DirectionResponse {
+		r.next++
+	}
+}
+
+// replayHandler implements modbus.ClientHandler for a Replay.
+type replayHandler struct {
+	rtuPackager
+	replay *Replay
+}
+
+// Send returns the captured response to aduRequest. The Replay mutex is held
+// by the caller.
+func (h *replayHandler) Send(aduRequest []byte) ([]byte, error) {
+	r := h.replay
+	r.skipResponses()
+	if r.next >= len(r.frames) {
+		return nil, fmt.Errorf("%w: no more captured requests for % x", ErrReplayMismatch, aduRequest)
+	}
+	captured := r.frames[r.next]
+	if !bytes.Equal(captured.ADU, aduRequest) {
+		return nil, fmt.Errorf("%w: request % x, captured % x", ErrReplayMismatch, aduRequest, captured.ADU)
+	}
+	r.next++
+	if r.next >= len(r.frames) || r.frames[r.next].Direction != DirectionResponse {
+		return nil, serial.ErrTimeout
+	}
+	response := r.frames[r.next]
+	r.next++
+	return response.ADU, nil
+}
@@ -0,0 +1,46 @@
+package cx34
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// countingTransport counts the requests passed to a Transport.
+type countingTransport struct {
+	Transport
+	requests int32
+}
+
+func (t *countingTransport) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return t.Transport.ReadHoldingRegisters(address, quantity)
+}
+
+func TestReplayMismatchIsNotRetried(t *testing.T) {
+	capture := captureHeader + "\n" +
+		"2026-10-18T04:12:18.377506519Z req " + hexReadSetpoints + "\n" +
+		"2026-10-18T04:12:18.418049361Z resp " + hexSetpoints + "\n"
+	replay, err := NewReplay(strings.NewReader(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &countingTransport{Transport: replay}
+	c := NewClient(tr, &Params{UnitId: 1, Retry: RetryPolicy{Attempts: 3}})
+
+	if _, err := c.ReadRegisters(RegisterRange{200, 200}); !errors.Is(err, ErrReplayMismatch) {
+		t.Fatalf("read not in the capture = %v, want ErrReplayMismatch", err)
+	}
+	if n := atomic.LoadInt32(&tr.requests); n != 1 {
+		t.Errorf("read not in the capture was sent %d times, want 1", n)
+	}
+
+	// The request that Connect makes first is answered from the capture.
+	if err := c.CheckConnection(); err != nil {
+		t.Fatalf("CheckConnection = %v", err)
+	}
+	if n := replay.Remaining(); n != 0 {
+		t.Errorf("%d captured requests not replayed", n)
+	}
+}
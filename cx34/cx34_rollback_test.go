@@ -0,0 +1,103 @@
+package cx34_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sodabrew/chilctl/cx34"
+	"github.com/sodabrew/chilctl/cx34/cx34test"
+	"github.com/sodabrew/chilctl/units"
+)
+
+var errInjected = errors.New("injected failure")
+
+// setpoints returns the values of the setpoint registers held by tr.
+func setpoints(tr *cx34test.FakeTransport) []uint16 {
+	values := tr.State().RegisterValues()
+	var s []uint16
+	for reg := cx34.OnOffMode; reg <= cx34.TargetDomesticHotWaterTemp; reg++ {
+		s = append(s, values[reg])
+	}
+	return s
+}
+
+// writesString formats writes as register:values, one per write.
+func writesString(writes []cx34test.Write) string {
+	var s []string
+	for _, w := range writes {
+		s = append(s, fmt.Sprintf("%d:%v", w.First, w.Values))
+	}
+	return fmt.Sprint(s)
+}
+
+// Turning the heat pump off and changing the DHW setpoint writes 140 and
+// 144 in two requests.
+func applyOffAndDHW(c *cx34.Client) error {
+	off := false
+	dhw := units.FromCelsius(45)
+	return c.ApplySettings(&cx34.Settings{On: &off, DHWTemp: &dhw})
+}
+
+func TestApplySettingsRestoresAfterFailedWrite(t *testing.T) {
+	tr := cx34test.MustLoadFixture("heating").Transport()
+	before := setpoints(tr)
+	tr.FailWrite(2, errInjected)
+	c := cx34.NewClient(tr, nil)
+
+	err := applyOffAndDHW(c)
+	if !errors.Is(err, errInjected) {
+		t.Fatalf("ApplySettings = %v, want the injected failure", err)
+	}
+	if got := setpoints(tr); fmt.Sprint(got) != fmt.Sprint(before) {
+		t.Errorf("setpoints after rollback = %v, want %v", got, before)
+	}
+	want := []string{"140:[0]", "140:[1]", "144:[51]"}
+	if got := writesString(tr.Writes()); got != fmt.Sprint(want) {
+		t.Errorf("writes = %s, want %v", got, want)
+	}
+}
+
+func TestApplySettingsRestoresAfterVerifyMismatch(t *testing.T) {
+	tr := cx34test.MustLoadFixture("heating").Transport()
+	before := setpoints(tr)
+	tr.IgnoreWrites(cx34.TargetDomesticHotWaterTemp)
+	c := cx34.NewClient(tr, &cx34.Params{VerifyWrites: true, Retry: cx34.RetryPolicy{Attempts: 2}})
+
+	err := applyOffAndDHW(c)
+	var mismatch *cx34.WriteMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("ApplySettings = %v, want a WriteMismatchError", err)
+	}
+	if mismatch.Register != cx34.TargetDomesticHotWaterTemp || mismatch.Wrote != 45 || mismatch.ReadBack != 51 {
+		t.Errorf("mismatch = %+v, want register 144 wrote 45 read back 51", mismatch)
+	}
+	if got := setpoints(tr); fmt.Sprint(got) != fmt.Sprint(before) {
+		t.Errorf("setpoints after rollback = %v, want %v", got, before)
+	}
+	// The write that did not take is tried again before giving up.
+	want := []string{"140:[0]", "144:[45]", "144:[45]", "140:[1]", "144:[51]"}
+	if got := writesString(tr.Writes()); got != fmt.Sprint(want) {
+		t.Errorf("writes = %s, want %v", got, want)
+	}
+}
+
+func TestApplySettingsFailedRestore(t *testing.T) {
+	tr := cx34test.MustLoadFixture("heating").Transport()
+	tr.FailWrite(2, errInjected)
+	tr.FailWrite(3, errors.New("restore failed"))
+	c := cx34.NewClient(tr, nil)
+
+	err := applyOffAndDHW(c)
+	if !errors.Is(err, errInjected) {
+		t.Fatalf("ApplySettings = %v, want the injected failure", err)
+	}
+	if !strings.Contains(err.Error(), "restoring prior settings also failed") || !strings.Contains(err.Error(), "restore failed") {
+		t.Errorf("ApplySettings = %v, want it to report the failed restore", err)
+	}
+	// The heat pump is left off: the restore stopped at its first failure.
+	if got := tr.State().OnOffMode(); got {
+		t.Errorf("OnOffMode = %t after the failed restore, want false", got)
+	}
+}
@@ -0,0 +1,236 @@
+package cx34
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/howeyc/crc16"
+)
+
+const (
+	// Size limits of a Modbus RTU frame, including slave address and CRC.
+	rtuMinSize = 4
+	rtuMaxSize = 256
+
+	// Size of an RTU exception response.
+	rtuExceptionSize = 5
+
+	// lateResponseWait is how long to wait for the rest of a response that
+	// timed out before sending the next request.
+	lateResponseWait = 50 * time.Millisecond
+)
+
+// rtuChecksum returns the Modbus CRC of b.
+func rtuChecksum(b []byte) uint16 {
+	return ^crc16.ChecksumIBM(b)
+}
+
+// rtuPackager implements modbus.Packager for RTU frames.
+type rtuPackager struct {
+	SlaveId byte
+}
+
+// Encode encodes the PDU into an RTU frame addressed to SlaveId.
+func (h *rtuPackager) Encode(pdu *modbus.ProtocolDataUnit) ([]byte, error) {
+	length := len(pdu.Data) + 4
+	if length > rtuMaxSize {
+		return nil, fmt.Errorf("modbus: length of data %d must not be bigger than %d", length, rtuMaxSize)
+	}
+	adu := make([]byte, length)
+	adu[0] = h.SlaveId
+	adu[1] = pdu.FunctionCode
+	copy(adu[2:], pdu.Data)
+	crc := rtuChecksum(adu[:length-2])
+	adu[length-2] = byte(crc)
+	adu[length-1] = byte(crc >> 8)
+	return adu, nil
+}
+
+// Decode checks the CRC of an RTU frame and returns its PDU.
+func (h *rtuPackager) Decode(adu []byte) (*modbus.ProtocolDataUnit, error) {
+	return decodeFrame(adu)
+}
+
+// Verify checks that the response came from the slave that was addressed.
+func (h *rtuPackager) Verify(aduRequest, aduResponse []byte) error {
+	if len(aduResponse) < rtuMinSize {
+		return fmt.Errorf("modbus: response length %d does not meet minimum %d", len(aduResponse), rtuMinSize)
+	}
+	if aduResponse[0] != aduRequest[0] {
+		return fmt.Errorf("modbus: response slave id %d does not match request %d", aduResponse[0], aduRequest[0])
+	}
+	return nil
+}
+
+// rtuSerialHandler is a modbus.RTUClientHandler whose responses are decoded
+// by decodeFrame, so that a bad CRC is reported as ErrCRCMismatch.
+type rtuSerialHandler struct {
+	*modbus.RTUClientHandler
+}
+
+// Decode checks the CRC of an RTU frame and returns its PDU.
+func (h *rtuSerialHandler) Decode(adu []byte) (*modbus.ProtocolDataUnit, error) {
+	return decodeFrame(adu)
+}
+
+// rtuOverTCPHandler implements modbus.ClientHandler for RTU frames carried
+// over a plain TCP stream, as exposed by ser2net and serial device servers.
+type rtuOverTCPHandler struct {
+	rtuPackager
+	Address string
+	Timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	// stale is set when the last response timed out, and may still arrive.
+	stale bool
+}
+
+func newRTUOverTCPHandler(address string) *rtuOverTCPHandler {
+	return &rtuOverTCPHandler{Address: address, Timeout: defaultTimeout}
+}
+
+// Connect dials Address if there is no open connection.
+func (h *rtuOverTCPHandler) Connect() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.connect()
+}
+
+func (h *rtuOverTCPHandler) connect() error {
+	if h.conn != nil {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", h.Address, h.Timeout)
+	if err != nil {
+		return err
+	}
+	h.conn = conn
+	return nil
+}
+
+// Close closes the connection, if any.
+func (h *rtuOverTCPHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.close()
+}
+
+func (h *rtuOverTCPHandler) close() error {
+	if h.conn == nil {
+		return nil
+	}
+	err := h.conn.Close()
+	h.conn = nil
+	h.stale = false
+	return err
+}
+
+// Send writes the request frame and reads back one response frame.
+//
+// A TCP stream carries no frame boundaries, so the length of the response is
+// worked out from its function code and byte count. After a timeout, which
+// may just mean that the addressed unit is silent, whatever arrives late is
+// discarded before the next request. Any other failure drops the connection,
+// so that stray bytes from a broken exchange cannot be mistaken for the start
+// of the next response.
+func (h *rtuOverTCPHandler) Send(aduRequest []byte) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.connect(); err != nil {
+		return nil, err
+	}
+	if h.stale {
+		if err := h.discard(); err != nil {
+			h.close()
+			return nil, err
+		}
+		h.stale = false
+	}
+	aduResponse, err := h.send(aduRequest)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		h.stale = true
+		return nil, err
+	}
+	if err != nil {
+		h.close()
+		return nil, err
+	}
+	return aduResponse, nil
+}
+
+// discard reads and drops the late response to a request that timed out.
+func (h *rtuOverTCPHandler) discard() error {
+	if err := h.conn.SetReadDeadline(time.Now().Add(lateResponseWait)); err != nil {
+		return err
+	}
+	var buf [rtuMaxSize]byte
+	for {
+		if _, err := h.conn.Read(buf[:]); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (h *rtuOverTCPHandler) send(aduRequest []byte) ([]byte, error) {
+	var deadline time.Time
+	if h.Timeout > 0 {
+		deadline = time.Now().Add(h.Timeout)
+	}
+	if err := h.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if _, err := h.conn.Write(aduRequest); err != nil {
+		return nil, err
+	}
+	var data [rtuMaxSize]byte
+	if _, err := io.ReadFull(h.conn, data[:3]); err != nil {
+		return nil, err
+	}
+	length, err := rtuResponseLength(data[:3])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(h.conn, data[3:length]); err != nil {
+		return nil, err
+	}
+	if _, err := decodeFrame(data[:length]); err != nil {
+		return nil, err
+	}
+	return data[:length], nil
+}
+
+// rtuResponseLength returns the total length of a response frame given its
+// first three bytes: slave address, function code and, for reads, byte count.
+func rtuResponseLength(header []byte) (int, error) {
+	functionCode := header[1]
+	switch {
+	case functionCode&0x80 != 0:
+		return rtuExceptionSize, nil
+	case functionCode == modbus.FuncCodeReadHoldingRegisters,
+		functionCode == modbus.FuncCodeReadInputRegisters,
+		functionCode == modbus.FuncCodeReadCoils,
+		functionCode == modbus.FuncCodeReadDiscreteInputs:
+		length := 5 + int(header[2])
+		if length > rtuMaxSize {
+			return 0, fmt.Errorf("modbus: response byte count %d is too large", header[2])
+		}
+		return length, nil
+	case functionCode == modbus.FuncCodeWriteSingleRegister,
+		functionCode == modbus.FuncCodeWriteMultipleRegisters,
+		functionCode == modbus.FuncCodeWriteSingleCoil,
+		functionCode == modbus.FuncCodeWriteMultipleCoils:
+		return 8, nil
+	}
+	return 0, fmt.Errorf("modbus: cannot determine length of response with function code %d", functionCode)
+}
@@ -0,0 +1,25 @@
+package cx34
+
+import "testing"
+
+func TestRTUResponseLength(t *testing.T) {
+	tests := []struct {
+		header  []byte
+		want    int
+		wantErr bool
+	}{
+		{[]byte{0x01, 0x03, 0x0a}, 15, false},
+		{[]byte{0x01, 0x03, 0xfa}, 255, false},
+		{[]byte{0x01, 0x03, 0xfc}, 0, true},
+		{[]byte{0x01, 0x03, 0xff}, 0, true},
+		{[]byte{0x01, 0x06, 0x00}, 8, false},
+		{[]byte{0x01, 0x83, 0x02}, 5, false},
+		{[]byte{0x01, 0x2b, 0x00}, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := rtuResponseLength(tt.header)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("rtuResponseLength(% x) = %d, %v, want %d, error %t", tt.header, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package cx34
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/golang/glog"
+)
+
+// Range of unit IDs a Modbus slave may use.
+const (
+	FirstUnitID = 1
+	LastUnitID  = 247
+)
+
+// defaultScanTimeout is how long Scan waits for each unit to answer, unless
+// Params.Timeout says otherwise. A CX34 answers within a few tens of
+// milliseconds at 9600 baud.
+const defaultScanTimeout = 250 * time.Millisecond
+
+// ScanResult describes a unit that answered during a Scan.
+type ScanResult struct {
+	UnitID int
+	// State holds the setpoint registers (on/off, mode and target
+	// temperatures) if the unit returned them. The CX34 has no known model
+	// register, so these are the best indication of what answered.
+	State *State
+	// Err is set if the unit answered but not with register values, for
+	// example with a Modbus exception or a corrupted response.
+	Err error
+}
+
+func (r *ScanResult) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("unit %d: responded with error: %v", r.UnitID, r.Err)
+	}
+	return fmt.Sprintf("unit %d: %s, mode %s", r.UnitID, onOffString(r.State.OnOffMode()), r.State.ACMode())
+}
+
+func onOffString(on bool) string {
+	if on {
+		return "on"
+	}
+	return "standby"
+}
+
+// Scan probes unit IDs first through last on the bus described by p and
+// returns the units that answered. Each unit gets a single request for the
+// setpoint registers, with no retries and a short timeout.
+func Scan(ctx context.Context, p *Params, first, last int) ([]*ScanResult, error) {
+	if first < FirstUnitID || last > LastUnitID || first > last {
+		return nil, fmt.Errorf("invalid unit id range %d-%d, want a range within %d-%d", first, last, FirstUnitID, LastUnitID)
+	}
+	scanParams := *p
+	scanParams.Retry = RetryPolicy{}
+	if scanParams.Timeout == 0 {
+		scanParams.Timeout = defaultScanTimeout
+	}
+	bus, err := OpenBus(&scanParams)
+	if err != nil {
+		return nil, err
+	}
+	defer bus.Close()
+
+	var found []*ScanResult
+	for id := first; id <= last; id++ {
+		state, err := bus.Client(id).ReadStateContext(ctx, WithGroups(Setpoints))
+		if ctx.Err() != nil {
+			return found, ctx.Err()
+		}
+		if err != nil && !answered(err) {
+			glog.V(1).Infof("unit %d: no response: %v", id, err)
+			continue
+		}
+		result := &ScanResult{UnitID: id, State: state, Err: err}
+		glog.Infof("found %v", result)
+		found = append(found, result)
+	}
+	return found, nil
+}
+
+// answered reports whether err shows that some device responded. A gateway
+// reporting that nothing answered on its bus does not count.
+func answered(err error) bool {
+	if errors.Is(err, ErrTimeout) {
+		return false
+	}
+	var exception *ExceptionError
+	if errors.As(err, &exception) {
+		return exception.ExceptionCode != modbus.ExceptionCodeGatewayPathUnavailable
+	}
+	return errors.Is(err, ErrCRCMismatch)
+}
@@ -0,0 +1,35 @@
+package cx34
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScanKeepsConnection(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	var accepted int32
+	go serveUnit(l, 3, &accepted)
+
+	p := &Params{
+		Mode:    Modbus,
+		Address: string(RTUOverTCP) + "://" + l.Addr().String(),
+		Timeout: 50 * time.Millisecond,
+	}
+	found, err := Scan(context.Background(), p, 1, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].UnitID != 3 || found[0].Err != nil {
+		t.Fatalf("Scan found %v, want unit 3", found)
+	}
+	if n := atomic.LoadInt32(&accepted); n != 1 {
+		t.Errorf("Scan opened %d connections, want 1", n)
+	}
+}
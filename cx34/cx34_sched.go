@@ -0,0 +1,80 @@
+package cx34
+
+import (
+	"context"
+	"sync"
+)
+
+// priority orders requests that are waiting for the bus.
+type priority int
+
+// Valid priorities, lowest first.
+const (
+	// readPriority is used for reads, such as background ReadState polling.
+	readPriority priority = iota
+	// writePriority is used for writes, so that a setting change does not
+	// wait behind a full register sweep.
+	writePriority
+
+	numPriorities
+)
+
+// scheduler serialises requests on a half-duplex bus. The bus is handed to
+// waiters in first-come, first-served order within a priority, and to all
+// waiting writes before any waiting read.
+type scheduler struct {
+	mu     sync.Mutex
+	busy   bool
+	queues [numPriorities][]chan struct{}
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{}
+}
+
+// acquire waits for the bus. It returns an error, without holding the bus,
+// if ctx is done first. Every successful acquire must be paired with a
+// release.
+func (s *scheduler) acquire(ctx context.Context, p priority) error {
+	s.mu.Lock()
+	if !s.busy {
+		s.busy = true
+		s.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	s.queues[p] = append(s.queues[p], ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	for i, w := range s.queues[p] {
+		if w == ready {
+			s.queues[p] = append(s.queues[p][:i], s.queues[p][i+1:]...)
+			s.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+	s.mu.Unlock()
+	// The bus was handed over while ctx was ending; pass it on.
+	s.release()
+	return ctx.Err()
+}
+
+// release hands the bus to the next waiter, if any.
+func (s *scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p := numPriorities - 1; p >= 0; p-- {
+		if q := s.queues[p]; len(q) > 0 {
+			s.queues[p] = q[1:]
+			close(q[0])
+			return
+		}
+	}
+	s.busy = false
+}
@@ -0,0 +1,219 @@
+package cx34
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sodabrew/chilctl/units"
+)
+
+// These tests are meant to be run with the race detector: go test -race
+
+// testTransport is a Transport backed by a register array. It records the
+// order of requests, and fails if two of them are ever in flight at once.
+type testTransport struct {
+	inFlight int32
+
+	mu        sync.Mutex
+	registers [lastHoldingRegister + 1]uint16
+	log       []string
+	// gate, if set, holds up the next request until it is closed.
+	gate    chan struct{}
+	started chan struct{}
+	// afterRead, if set, is called once after the next read, with the mutex
+	// held, to change registers behind the client's back.
+	afterRead func()
+}
+
+func (t *testTransport) begin(op string) error {
+	if atomic.AddInt32(&t.inFlight, 1) != 1 {
+		return errors.New("concurrent requests on a half-duplex bus")
+	}
+	t.mu.Lock()
+	t.log = append(t.log, op)
+	gate, started := t.gate, t.started
+	t.gate = nil
+	t.mu.Unlock()
+	if gate != nil {
+		close(started)
+		<-gate
+	}
+	return nil
+}
+
+func (t *testTransport) end() {
+	atomic.AddInt32(&t.inFlight, -1)
+}
+
+func (t *testTransport) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	defer t.end()
+	if err := t.begin(fmt.Sprintf("read %d", address)); err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	results := make([]byte, 2*int(quantity))
+	for i := 0; i < int(quantity); i++ {
+		binary.BigEndian.PutUint16(results[2*i:], t.registers[int(address)+i])
+	}
+	if f := t.afterRead; f != nil {
+		t.afterRead = nil
+		f()
+	}
+	return results, nil
+}
+
+func (t *testTransport) WriteSingleRegister(address, value uint16) ([]byte, error) {
+	defer t.end()
+	if err := t.begin(fmt.Sprintf("write %d", address)); err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.registers[address] = value
+	return []byte{byte(address >> 8), byte(address), byte(value >> 8), byte(value)}, nil
+}
+
+func (t *testTransport) WriteMultipleRegisters(address, quantity uint16, value []byte) ([]byte, error) {
+	defer t.end()
+	if err := t.begin(fmt.Sprintf("write %d", address)); err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := 0; i < int(quantity); i++ {
+		t.registers[int(address)+i] = binary.BigEndian.Uint16(value[2*i:])
+	}
+	return []byte{byte(address >> 8), byte(address), byte(quantity >> 8), byte(quantity)}, nil
+}
+
+// hold makes the next request wait until release is called. started is
+// closed once that request is on the wire.
+func (t *testTransport) hold() (started <-chan struct{}, release func()) {
+	gate := make(chan struct{})
+	t.mu.Lock()
+	t.gate = gate
+	t.started = make(chan struct{})
+	started = t.started
+	t.mu.Unlock()
+	return started, func() { close(gate) }
+}
+
+// waitQueued waits until n requests of priority p are waiting for the bus.
+func waitQueued(t *testing.T, s *scheduler, p priority, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		queued := len(s.queues[p])
+		s.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d requests at priority %d", n, p)
+}
+
+func TestClientWritesAheadOfReads(t *testing.T) {
+	tr := &testTransport{}
+	c := NewClient(tr, nil)
+	started, release := tr.hold()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	read := func(reg Register) {
+		defer wg.Done()
+		_, err := c.ReadRegisters(RegisterRange{reg, reg})
+		errs <- err
+	}
+	wg.Add(1)
+	go read(200)
+	// Wait for the first read to be on the wire before queueing the rest.
+	<-started
+	for _, reg := range []Register{201, 202, 203} {
+		wg.Add(1)
+		go read(reg)
+		waitQueued(t, c.sched, readPriority, int(reg-200))
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errs <- c.SetHeatingTemp(units.FromCelsius(40))
+	}()
+	waitQueued(t, c.sched, writePriority, 1)
+
+	release()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"read 200", "write 143", "read 201", "read 202", "read 203"}
+	if fmt.Sprint(tr.log) != fmt.Sprint(want) {
+		t.Errorf("requests went out in order %v, want %v", tr.log, want)
+	}
+}
+
+func TestClientConcurrentReadsAndWrites(t *testing.T) {
+	tr := &testTransport{}
+	c := NewClient(tr, nil)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := c.ReadState()
+			errs <- err
+		}()
+		go func(i int) {
+			defer wg.Done()
+			errs <- c.SetDomesticHotWaterTemp(units.FromCelsius(float64(40 + i)))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if got := tr.registers[TargetDomesticHotWaterTemp]; got < 40 || got >= 60 {
+		t.Errorf("DHW setpoint = %d, want one of the values written", got)
+	}
+}
+
+func TestSchedulerCancelledWaiter(t *testing.T) {
+	s := newScheduler()
+	if err := s.acquire(context.Background(), readPriority); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.acquire(ctx, writePriority) }()
+	waitQueued(t, s, writePriority, 1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("acquire after cancel = %v, want context.Canceled", err)
+	}
+	s.release()
+
+	// The bus must be free again, not held by the cancelled waiter.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.acquire(ctx, readPriority); err != nil {
+		t.Fatalf("acquire after release = %v", err)
+	}
+	s.release()
+}
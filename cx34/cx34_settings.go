@@ -0,0 +1,218 @@
+package cx34
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"github.com/sodabrew/chilctl/units"
+)
+
+// Settings is a change to the writable registers 140-144. Nil fields are left
+// unchanged.
+type Settings struct {
+	On          *bool
+	Mode        *AirConditioningMode
+	CoolingTemp *units.Temperature
+	HeatingTemp *units.Temperature
+	DHWTemp     *units.Temperature
+}
+
+// String returns a human-readable summary of the changes.
+func (s *Settings) String() string {
+	var parts []string
+	if s.On != nil {
+		parts = append(parts, fmt.Sprintf("on=%t", *s.On))
+	}
+	if s.Mode != nil {
+		parts = append(parts, fmt.Sprintf("mode=%s", *s.Mode))
+	}
+	if s.CoolingTemp != nil {
+		parts = append(parts, fmt.Sprintf("cooling=%.1f°C", s.CoolingTemp.Celsius()))
+	}
+	if s.HeatingTemp != nil {
+		parts = append(parts, fmt.Sprintf("heating=%.1f°C", s.HeatingTemp.Celsius()))
+	}
+	if s.DHWTemp != nil {
+		parts = append(parts, fmt.Sprintf("dhw=%.1f°C", s.DHWTemp.Celsius()))
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// registerValues validates the settings and returns the register values to
+// write.
+func (s *Settings) registerValues() (map[Register]uint16, error) {
+	values := make(map[Register]uint16)
+	if s.On != nil {
+		values[OnOffMode] = 0
+		if *s.On {
+			values[OnOffMode] = 1
+		}
+	}
+	if s.Mode != nil {
+		v, err := acModeValue(*s.Mode)
+		if err != nil {
+			return nil, err
+		}
+		values[ACMode] = v
+	}
+	temps := []struct {
+		reg  Register
+		t    *units.Temperature
+		name string
+	}{
+		{TargetACCoolingModeTemp, s.CoolingTemp, "cooling"},
+		{TargetACHeatingModeTemp, s.HeatingTemp, "heating"},
+		{TargetDomesticHotWaterTemp, s.DHWTemp, "DHW"},
+	}
+	for _, temp := range temps {
+		if temp.t == nil {
+			continue
+		}
+		v, err := targetTempValue(*temp.t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s target: %w", temp.name, err)
+		}
+		values[temp.reg] = v
+	}
+	return values, nil
+}
+
+// ApplySettings changes several settings at once. All settings are validated
+// before anything is written, and neighbouring registers are written in a
+// single WriteMultipleRegisters request where the heat pump supports it.
+// Registers that s leaves unchanged are not written, so a concurrent change
+// to one of them is not overwritten.
+//
+// If Params.VerifyWrites is set, registers that do not read back as written
+// are written again, as for single registers. If a write fails, or a
+// register still does not read back as written, the registers are restored
+// to their prior values.
+func (c *Client) ApplySettings(s *Settings) error {
+	return c.ApplySettingsContext(context.Background(), s)
+}
+
+// ApplySettingsContext is like ApplySettings but gives up when ctx is done.
+// Restoring prior values after a failure is not cut short by ctx.
+func (c *Client) ApplySettingsContext(ctx context.Context, s *Settings) error {
+	want, err := s.registerValues()
+	if err != nil {
+		return err
+	}
+	if len(want) == 0 {
+		return nil
+	}
+	var ranges []RegisterRange
+	for reg := range want {
+		ranges = append(ranges, RegisterRange{reg, reg})
+	}
+	runs, err := mergeRanges(ranges)
+	if err != nil {
+		return err
+	}
+
+	prior, err := c.ReadRegistersContext(ctx, runs...)
+	if err != nil {
+		return fmt.Errorf("error reading current settings: %w", err)
+	}
+	for i, run := range runs {
+		if err := c.writeBlock(ctx, run.First, run.values(want)); err != nil {
+			return c.restore(runs[:i+1], prior.registerValues, err)
+		}
+	}
+	if c.verify {
+		if err := c.verifyRuns(ctx, runs, want); err != nil {
+			return c.restore(runs, prior.registerValues, err)
+		}
+	}
+	glog.Infof("applied settings %v", s)
+	return nil
+}
+
+// verifyRuns reads back the registers in runs and writes the runs that
+// differ from want again, up to Retry.Attempts times in all.
+func (c *Client) verifyRuns(ctx context.Context, runs []RegisterRange, want map[Register]uint16) error {
+	attempts := c.retry.attempts()
+	for attempt := 1; ; attempt++ {
+		got, err := c.ReadRegistersContext(ctx, runs...)
+		if err != nil {
+			return fmt.Errorf("error reading back settings: %w", err)
+		}
+		var mismatch error
+		var again []RegisterRange
+		for _, run := range runs {
+			for reg := run.First; reg <= run.Last; reg++ {
+				if got.registerValues[reg] != want[reg] {
+					if mismatch == nil {
+						mismatch = &WriteMismatchError{Register: reg, Wrote: want[reg], ReadBack: got.registerValues[reg]}
+					}
+					again = append(again, run)
+					break
+				}
+			}
+		}
+		if mismatch == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return mismatch
+		}
+		glog.Warningf("%v (attempt %d of %d), writing again", mismatch, attempt, attempts)
+		for _, run := range again {
+			if err := c.writeBlock(ctx, run.First, run.values(want)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// values returns the values in m of the registers in r.
+func (r RegisterRange) values(m map[Register]uint16) []uint16 {
+	values := make([]uint16, r.Len())
+	for i := range values {
+		values[i] = m[r.First+Register(i)]
+	}
+	return values
+}
+
+// writeBlock writes contiguous registers starting at first. If the heat pump
+// does not support WriteMultipleRegisters, the registers are written one at
+// a time.
+func (c *Client) writeBlock(ctx context.Context, first Register, values []uint16) error {
+	data := make([]byte, 2*len(values))
+	for i, v := range values {
+		data[2*i] = byte(v >> 8)
+		data[2*i+1] = byte(v)
+	}
+	res, err := c.call(ctx, writePriority, func() ([]byte, error) {
+		return c.c.WriteMultipleRegisters(first.uint16(), uint16(len(values)), data)
+	})
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrIllegalFunction) {
+		return fmt.Errorf("WriteMultipleRegisters error: %w (returned bytes %v)", err, res)
+	}
+	glog.Infof("WriteMultipleRegisters not supported, writing registers one at a time")
+	for i, v := range values {
+		if err := c.writeSingle(ctx, first+Register(i), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restore writes back the prior register values in runs after cause made
+// applying settings fail, and returns the error to report.
+func (c *Client) restore(runs []RegisterRange, prior map[Register]uint16, cause error) error {
+	glog.Warningf("restoring prior settings after error: %v", cause)
+	for _, run := range runs {
+		if err := c.writeBlock(context.Background(), run.First, run.values(prior)); err != nil {
+			return fmt.Errorf("%w; restoring prior settings also failed: %v", cause, err)
+		}
+	}
+	return fmt.Errorf("settings restored after error: %w", cause)
+}
@@ -0,0 +1,58 @@
+package cx34
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sodabrew/chilctl/units"
+)
+
+func TestApplySettingsWritesOnlyChangedRegisters(t *testing.T) {
+	tr := &testTransport{}
+	tr.registers[OnOffMode] = 1
+	tr.registers[ACMode] = uint16(AirConditioningModeHeating)
+	tr.registers[TargetACCoolingModeTemp] = 12
+	tr.registers[TargetACHeatingModeTemp] = 39
+	tr.registers[TargetDomesticHotWaterTemp] = 51
+	// Someone changes the cooling setpoint between ApplySettings reading the
+	// current settings and writing the new ones.
+	tr.afterRead = func() { tr.registers[TargetACCoolingModeTemp] = 15 }
+	c := NewClient(tr, &Params{VerifyWrites: true})
+
+	off := false
+	dhw := units.FromCelsius(45)
+	if err := c.ApplySettings(&Settings{On: &off, DHWTemp: &dhw}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [...]uint16{0, uint16(AirConditioningModeHeating), 15, 39, 45}
+	for i, v := range want {
+		reg := OnOffMode + Register(i)
+		if got := tr.registers[reg]; got != v {
+			t.Errorf("register %v = %d, want %d", reg, got, v)
+		}
+	}
+	wantLog := []string{"read 140", "write 140", "write 144", "read 140"}
+	if fmt.Sprint(tr.log) != fmt.Sprint(wantLog) {
+		t.Errorf("requests = %v, want %v", tr.log, wantLog)
+	}
+}
+
+func TestApplySettingsSingleBlock(t *testing.T) {
+	tr := &testTransport{}
+	c := NewClient(tr, nil)
+
+	mode := AirConditioningModeCooling
+	cooling := units.FromCelsius(10)
+	heating := units.FromCelsius(40)
+	if err := c.ApplySettings(&Settings{Mode: &mode, CoolingTemp: &cooling, HeatingTemp: &heating}); err != nil {
+		t.Fatal(err)
+	}
+	wantLog := []string{"read 141", "write 141"}
+	if fmt.Sprint(tr.log) != fmt.Sprint(wantLog) {
+		t.Errorf("requests = %v, want %v", tr.log, wantLog)
+	}
+	if got := tr.registers[TargetACHeatingModeTemp]; got != 40 {
+		t.Errorf("heating setpoint = %d, want 40", got)
+	}
+}
@@ -0,0 +1,278 @@
+package cx34
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+	"github.com/golang/glog"
+)
+
+// Sniffer reconstructs the state of the heat pumps on a bus by listening to
+// the Modbus RTU traffic of another master, such as the Chiltrix wired
+// controller, without sending anything itself.
+//
+// Raw bytes written to the Sniffer are split into frames, read requests are
+// paired with their responses, and the register values they carry are
+// recorded in one Monitor per unit. Acknowledged writes are recorded too. A
+// Sniffer is safe for concurrent use.
+type Sniffer struct {
+	mu       sync.Mutex
+	framer   *RTUFramer
+	tracker  rtuTracker
+	monitors map[int]*Monitor
+	capture  FrameWriter
+}
+
+// NewSniffer returns a Sniffer, that has not seen any traffic, for a bus
+// running at baud. If baud is 0, the default of 9600 baud is assumed.
+func NewSniffer(baud int) *Sniffer {
+	return &Sniffer{
+		framer:   NewRTUFramer(baud),
+		monitors: make(map[int]*Monitor),
+	}
+}
+
+// Write feeds bytes read from the bus to the Sniffer as they arrive. Frames
+// may be split across or concatenated within calls. It never fails, so that
+// a serial port can be copied into it.
+func (s *Sniffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observe(s.framer.Feed(time.Now(), p))
+	return len(p), nil
+}
+
+// SetCapture records every frame the Sniffer sees to w, for example a
+// CaptureWriter or a PcapWriter.
+func (s *Sniffer) SetCapture(w FrameWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capture = w
+}
+
+// Flush processes the frame still buffered. Call it when the bus has been
+// idle, so that the last response is not held back until the next request.
+func (s *Sniffer) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observe(s.framer.Flush())
+}
+
+// observe records the register values confirmed by frames. Caller must hold
+// the mutex.
+func (s *Sniffer) observe(frames []RTUFrame) {
+	for _, frame := range frames {
+		tx, dir := s.tracker.observe(frame.ADU)
+		if s.capture != nil {
+			if err := s.capture.WriteFrame(frame.Time, dir, frame.ADU); err != nil {
+				glog.Warningf("error writing capture: %v", err)
+			}
+		}
+		if tx == nil {
+			continue
+		}
+		glog.V(1).Info(tx)
+		if tx.exception != 0 || len(tx.values) == 0 {
+			continue
+		}
+		s.monitor(int(tx.unit)).Observe(frame.Time, tx.first, tx.values)
+	}
+}
+
+// Monitor returns the Monitor holding the registers observed for unitID.
+func (s *Sniffer) Monitor(unitID int) *Monitor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.monitor(unitID)
+}
+
+func (s *Sniffer) monitor(unitID int) *Monitor {
+	m, ok := s.monitors[unitID]
+	if !ok {
+		m = NewMonitor()
+		s.monitors[unitID] = m
+	}
+	return m
+}
+
+// State returns a snapshot of the registers observed for unitID, or nil if
+// none have been.
+func (s *Sniffer) State(unitID int) *State {
+	return s.Monitor(unitID).State()
+}
+
+// Units returns, in ascending order, the unit ids for which register values
+// have been observed.
+func (s *Sniffer) Units() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []int
+	for id, m := range s.monitors {
+		if m.State() != nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Sniff opens p.TTYDevice and feeds everything received on it to s until ctx
+// is done or reading fails. Nothing is ever sent on the port.
+func Sniff(ctx context.Context, p *Params, s *Sniffer) error {
+	if p.Address != "" {
+		return fmt.Errorf("sniffing requires a serial device, not a network address")
+	}
+	config := newSerialHandler(p).Config
+	// Wake up regularly to flush the last frame and to notice that ctx is
+	// done on a quiet bus.
+	config.Timeout = 100 * time.Millisecond
+	port, err := serial.Open(&config)
+	if err != nil {
+		return fmt.Errorf("serial.Open failure: %w", err)
+	}
+	defer port.Close()
+
+	var buf [rtuMaxSize]byte
+	for ctx.Err() == nil {
+		n, err := port.Read(buf[:])
+		if n > 0 {
+			s.Write(buf[:n])
+		}
+		if errors.Is(err, serial.ErrTimeout) {
+			s.Flush()
+		} else if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// rtuTracker pairs the RTU requests seen on a bus with their responses.
+// Responses to reads do not repeat the register address, so it is taken
+// from the outstanding request of the same unit.
+type rtuTracker struct {
+	pending map[byte]*rtuTransaction
+}
+
+// rtuTransaction is a request, completed by its response once seen.
+type rtuTransaction struct {
+	unit         byte
+	functionCode byte
+	first        Register
+	quantity     int
+	// values holds the registers written by the request, or read by the
+	// response.
+	values []uint16
+	// exception is the exception code of the response, if any.
+	exception byte
+
+	request []byte
+}
+
+// observe interprets a frame that passed the CRC check. It returns whether
+// the frame is a request or a response, and the transaction it completes,
+// if any.
+func (t *rtuTracker) observe(frame []byte) (*rtuTransaction, Direction) {
+	if t.pending == nil {
+		t.pending = make(map[byte]*rtuTransaction)
+	}
+	if len(frame) < rtuMinSize {
+		return nil, DirectionUnknown
+	}
+	unit, functionCode, data := frame[0], frame[1], frame[2:len(frame)-2]
+	pending := t.pending[unit]
+
+	if functionCode&0x80 != 0 {
+		delete(t.pending, unit)
+		if pending == nil || pending.functionCode != functionCode&0x7f || len(data) < 1 {
+			return nil, DirectionResponse
+		}
+		pending.exception = data[0]
+		return pending, DirectionResponse
+	}
+
+	switch functionCode {
+	case modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadInputRegisters:
+		if len(data) == 4 {
+			// Responses always have an even byte count, so cannot be 8 bytes.
+			t.pending[unit] = &rtuTransaction{
+				unit:         unit,
+				functionCode: functionCode,
+				first:        Register(binary.BigEndian.Uint16(data[0:2])),
+				quantity:     int(binary.BigEndian.Uint16(data[2:4])),
+			}
+			return nil, DirectionRequest
+		}
+		delete(t.pending, unit)
+		if pending == nil || pending.functionCode != functionCode || len(data) != 1+2*pending.quantity || int(data[0]) != 2*pending.quantity {
+			return nil, DirectionResponse
+		}
+		pending.values = registerValues(data[1:])
+		return pending, DirectionResponse
+
+	case modbus.FuncCodeWriteSingleRegister:
+		if len(data) != 4 {
+			delete(t.pending, unit)
+			return nil, DirectionUnknown
+		}
+		// The response echoes the request, so the second of two identical
+		// frames is taken to be the response.
+		if pending != nil && pending.functionCode == functionCode && string(pending.request) == string(frame) {
+			delete(t.pending, unit)
+			return pending, DirectionResponse
+		}
+		t.pending[unit] = &rtuTransaction{
+			unit:         unit,
+			functionCode: functionCode,
+			first:        Register(binary.BigEndian.Uint16(data[0:2])),
+			quantity:     1,
+			values:       registerValues(data[2:4]),
+			request:      frame,
+		}
+		return nil, DirectionRequest
+
+	case modbus.FuncCodeWriteMultipleRegisters:
+		if len(data) < 4 {
+			delete(t.pending, unit)
+			return nil, DirectionUnknown
+		}
+		first := Register(binary.BigEndian.Uint16(data[0:2]))
+		quantity := int(binary.BigEndian.Uint16(data[2:4]))
+		if len(data) != 4 {
+			if len(data) != 5+2*quantity {
+				delete(t.pending, unit)
+				return nil, DirectionRequest
+			}
+			t.pending[unit] = &rtuTransaction{
+				unit:         unit,
+				functionCode: functionCode,
+				first:        first,
+				quantity:     quantity,
+				values:       registerValues(data[5:]),
+			}
+			return nil, DirectionRequest
+		}
+		delete(t.pending, unit)
+		if pending == nil || pending.functionCode != functionCode || pending.first != first || pending.quantity != quantity {
+			return nil, DirectionResponse
+		}
+		return pending, DirectionResponse
+	}
+	return nil, DirectionUnknown
+}
+
+// registerValues decodes big-endian register values.
+func registerValues(b []byte) []uint16 {
+	values := make([]uint16, len(b)/2)
+	for i := range values {
+		values[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	return values
+}
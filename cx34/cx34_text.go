@@ -0,0 +1,289 @@
+package cx34
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/goburrow/serial"
+	"github.com/golang/glog"
+)
+
+// The CX34Text mode listens to the Omron CompoWay/F traffic between the
+// controller and the outdoor unit. CompoWay/F frames are ASCII text:
+//
+//	STX | node (2) | sub-address (2) | SID (1) | MRC (2) | SRC (2) | data | ETX | BCC
+//
+// for commands, and
+//
+//	STX | node (2) | sub-address (2) | end code (2) | MRC (2) | SRC (2) | response code (4) | data | ETX | BCC
+//
+// for responses, where BCC is the XOR of every byte after STX up to and
+// including ETX.
+//
+// Register values are taken from "read variable area" (MRC 01, SRC 01)
+// responses, and from "write variable area" (MRC 01, SRC 02) commands that
+// were acknowledged. Variable area addresses are mapped one-to-one onto
+// holding register numbers; this follows the Modbus register map, but has not
+// been confirmed against traffic from a CX34.
+//
+// Frames are told apart by their order rather than their content: the master
+// waits for each response before sending the next command, so a frame from a
+// node with a command pending is taken to be the response to it.
+const (
+	textSTX = 0x02
+	textETX = 0x03
+
+	// Longest frame accepted before resynchronizing on the next STX.
+	textMaxFrameSize = 1024
+
+	textMRCVariableArea = "01"
+	textSRCRead         = "01"
+	textSRCWrite        = "02"
+
+	textEndCodeNormal      = "00"
+	textResponseCodeNormal = "0000"
+)
+
+// ErrReadOnly is returned by writes on a connection that only listens.
+var ErrReadOnly = errors.New("cx34: connection is read-only")
+
+// textRequest is a variable area command awaiting its response.
+type textRequest struct {
+	src      string
+	address  Register
+	elemSize int // hex digits per element
+	count    int
+	values   []uint16 // for writes
+}
+
+// TextDecoder decodes CompoWay/F traffic read from a serial line into
+// register values.
+type TextDecoder struct {
+	r       *bufio.Reader
+	pending map[string]*textRequest // by node number
+}
+
+// NewTextDecoder returns a decoder reading from r.
+func NewTextDecoder(r io.Reader) *TextDecoder {
+	return &TextDecoder{
+		r:       bufio.NewReader(r),
+		pending: make(map[string]*textRequest),
+	}
+}
+
+// Run decodes frames and records the register values they carry in m until
+// reading fails. Read timeouts from the serial port are ignored.
+func (d *TextDecoder) Run(m *Monitor) error {
+	for {
+		frame, err := d.readFrame()
+		if errors.Is(err, serial.ErrTimeout) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		first, values, err := d.decodeFrame(frame)
+		if err != nil {
+			glog.V(1).Infof("skipping CompoWay/F frame %q: %v", frame, err)
+			continue
+		}
+		m.Observe(time.Now(), first, values)
+	}
+}
+
+// readFrame returns the text between STX and ETX of the next frame with a
+// valid BCC.
+func (d *TextDecoder) readFrame() ([]byte, error) {
+	for {
+		// Skip to the start of a frame.
+		for {
+			b, err := d.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if b == textSTX {
+				break
+			}
+		}
+		var frame []byte
+		bcc := byte(0)
+		for {
+			b, err := d.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			bcc ^= b
+			if b == textETX {
+				break
+			}
+			if b == textSTX || len(frame) >= textMaxFrameSize {
+				// Start over on a new or garbled frame.
+				frame, bcc = frame[:0], 0
+				continue
+			}
+			frame = append(frame, b)
+		}
+		want, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if want != bcc {
+			glog.V(1).Infof("skipping CompoWay/F frame %q: BCC %#x does not match expected %#x", frame, want, bcc)
+			continue
+		}
+		return frame, nil
+	}
+}
+
+// decodeFrame interprets the text of a frame. It returns register values if
+// the frame completes a variable area read or write.
+func (d *TextDecoder) decodeFrame(frame []byte) (Register, []uint16, error) {
+	text := string(frame)
+	if len(text) < 9 {
+		return 0, nil, fmt.Errorf("frame too short")
+	}
+	node, rest := text[0:2], text[4:]
+	req := d.pending[node]
+	delete(d.pending, node)
+	if req != nil && isTextResponse(rest, req) {
+		return d.decodeResponse(node, req, rest)
+	}
+	return 0, nil, d.decodeCommand(node, rest[1:])
+}
+
+// isTextResponse reports whether text, following the sub-address, is a
+// response to req rather than a new command.
+func isTextResponse(text string, req *textRequest) bool {
+	return len(text) >= 10 && text[2:4] == textMRCVariableArea && text[4:6] == req.src
+}
+
+// decodeCommand records a variable area command from the text following the
+// SID.
+func (d *TextDecoder) decodeCommand(node, text string) error {
+	if len(text) < 16 || text[0:2] != textMRCVariableArea {
+		return nil
+	}
+	src := text[2:4]
+	if src != textSRCRead && src != textSRCWrite {
+		return nil
+	}
+	req, err := parseTextVariableArea(text[4:16])
+	if err != nil {
+		return err
+	}
+	req.src = src
+	if src == textSRCWrite {
+		req.values, err = parseTextValues(text[16:], req.elemSize, req.count)
+		if err != nil {
+			return err
+		}
+	}
+	d.pending[node] = req
+	return nil
+}
+
+// decodeResponse decodes the response to req, given the text following the
+// sub-address.
+func (d *TextDecoder) decodeResponse(node string, req *textRequest, text string) (Register, []uint16, error) {
+	if text[0:2] != textEndCodeNormal || text[6:10] != textResponseCodeNormal {
+		return 0, nil, fmt.Errorf("unit %s rejected command with end code %s, response code %s", node, text[0:2], text[6:10])
+	}
+	if req.src == textSRCWrite {
+		return req.address, req.values, nil
+	}
+	values, err := parseTextValues(text[10:], req.elemSize, req.count)
+	if err != nil {
+		return 0, nil, err
+	}
+	return req.address, values, nil
+}
+
+// parseTextVariableArea parses the variable type, address, bit position and
+// element count of a variable area command.
+func parseTextVariableArea(text string) (*textRequest, error) {
+	varType, err := strconv.ParseUint(text[0:2], 16, 8)
+	if err != nil {
+		return nil, fmt.Errorf("bad variable type %q", text[0:2])
+	}
+	address, err := strconv.ParseUint(text[2:6], 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("bad address %q", text[2:6])
+	}
+	count, err := strconv.ParseUint(text[8:12], 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("bad element count %q", text[8:12])
+	}
+	// Types C0-CF hold double words, 80-8F single words.
+	elemSize := 4
+	if varType&0xF0 == 0xC0 {
+		elemSize = 8
+	}
+	return &textRequest{address: Register(address), elemSize: elemSize, count: int(count)}, nil
+}
+
+// parseTextValues parses count hex-encoded elements. Double word elements
+// are truncated to their low 16 bits, which keeps the sign of small
+// negative values.
+func parseTextValues(text string, elemSize, count int) ([]uint16, error) {
+	if len(text) < elemSize*count {
+		return nil, fmt.Errorf("got %d characters of data, want %d", len(text), elemSize*count)
+	}
+	values := make([]uint16, count)
+	for i := range values {
+		elem := text[i*elemSize : (i+1)*elemSize]
+		v, err := strconv.ParseUint(elem, 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad element %q", elem)
+		}
+		values[i] = uint16(v)
+	}
+	return values, nil
+}
+
+// connectText opens p.TTYDevice and returns a client whose state comes from
+// the CompoWay/F traffic on it.
+func connectText(p *Params) (*Client, error) {
+	config := newSerialHandler(p).Config
+	port, err := serial.Open(&config)
+	if err != nil {
+		return nil, fmt.Errorf("serial.Open failure: %w", err)
+	}
+	var r io.Reader = port
+	if p.LogWriter != nil {
+		r = io.TeeReader(port, p.LogWriter)
+	}
+	m := NewMonitor()
+	go func() {
+		err := NewTextDecoder(r).Run(m)
+		glog.Infof("stopped decoding CompoWay/F traffic: %v", err)
+	}()
+	c := NewClient(&passiveTransport{port}, p)
+	c.monitor = m
+	c.passiveTimeout = p.timeout()
+	return c, nil
+}
+
+// passiveTransport is the Transport of a client that only listens.
+type passiveTransport struct {
+	io.Closer
+}
+
+// ReadHoldingRegisters implements Transport. Reads are answered by the
+// client's Monitor instead.
+func (t *passiveTransport) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	return nil, ErrReadOnly
+}
+
+// WriteSingleRegister implements Transport.
+func (t *passiveTransport) WriteSingleRegister(address, value uint16) ([]byte, error) {
+	return nil, ErrReadOnly
+}
+
+// WriteMultipleRegisters implements Transport.
+func (t *passiveTransport) WriteMultipleRegisters(address, quantity uint16, value []byte) ([]byte, error) {
+	return nil, ErrReadOnly
+}
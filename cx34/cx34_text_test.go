@@ -0,0 +1,226 @@
+package cx34
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+// compowayFrame wraps body in STX, ETX and BCC.
+func compowayFrame(body string) []byte {
+	frame := append([]byte{textSTX}, body...)
+	frame = append(frame, textETX)
+	bcc := byte(0)
+	for _, b := range frame[1:] {
+		bcc ^= b
+	}
+	return append(frame, bcc)
+}
+
+// Frames laid out as in the CompoWay/F specification: node 01, sub-address
+// 00, SID 0, then MRC/SRC 0101 (read variable area) or 0102 (write variable
+// area), variable type, address, bit position 00 and element count. They are
+// built from the specification, as no recording of CX34 traffic is available.
+var (
+	// Read 3 words of type 82 from address 00C8.
+	textReadCommand  = "01000" + "0101" + "82" + "00C8" + "00" + "0003"
+	textReadResponse = "0100" + "00" + "0101" + "0000" + "0016" + "02BC" + "FFDD"
+	// Write 1 double word of type C2 to address 008F.
+	textWriteCommand  = "01000" + "0102" + "C2" + "008F" + "00" + "0001" + "00000027"
+	textWriteResponse = "0100" + "00" + "0102" + "0000"
+)
+
+func decodeTextStream(t *testing.T, bodies ...string) *Monitor {
+	t.Helper()
+	var stream bytes.Buffer
+	for _, body := range bodies {
+		stream.Write(compowayFrame(body))
+	}
+	m := NewMonitor()
+	if err := NewTextDecoder(&stream).Run(m); !errors.Is(err, io.EOF) {
+		t.Fatalf("Run = %v, want io.EOF", err)
+	}
+	return m
+}
+
+func registerValuesString(s *State) string {
+	if s == nil {
+		return "nil"
+	}
+	return fmt.Sprint(s.RegisterValues())
+}
+
+func TestTextDecoder(t *testing.T) {
+	tests := []struct {
+		name   string
+		bodies []string
+		want   map[Register]uint16
+	}{
+		{
+			name:   "read",
+			bodies: []string{textReadCommand, textReadResponse},
+			want:   map[Register]uint16{200: 0x16, 201: 0x2bc, 202: 0xffdd},
+		},
+		{
+			name:   "write",
+			bodies: []string{textWriteCommand, textWriteResponse},
+			want:   map[Register]uint16{143: 0x27},
+		},
+		{
+			name:   "joined mid-exchange",
+			bodies: []string{textReadResponse, textWriteCommand, textWriteResponse},
+			want:   map[Register]uint16{143: 0x27},
+		},
+		{
+			name:   "lost response",
+			bodies: []string{textWriteCommand, textReadCommand, textReadResponse},
+			want:   map[Register]uint16{200: 0x16, 201: 0x2bc, 202: 0xffdd},
+		},
+		{
+			name:   "rejected write",
+			bodies: []string{textWriteCommand, "0100" + "14" + "0102" + "0000"},
+			want:   nil,
+		},
+		{
+			name:   "error response code",
+			bodies: []string{textWriteCommand, "0100" + "00" + "0102" + "1100"},
+			want:   nil,
+		},
+		{
+			name:   "short data",
+			bodies: []string{textReadCommand, "0100" + "00" + "0101" + "0000" + "0016"},
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decodeTextStream(t, tt.bodies...).State()
+			var want *State
+			if tt.want != nil {
+				want = &State{registerValues: tt.want}
+			}
+			if registerValuesString(got) != registerValuesString(want) {
+				t.Errorf("decoded %s, want %s", registerValuesString(got), registerValuesString(want))
+			}
+		})
+	}
+}
+
+func TestTextDecoderSkipsNoise(t *testing.T) {
+	var stream bytes.Buffer
+	stream.WriteString("\x00\xff")
+	bad := compowayFrame(textReadCommand)
+	bad[len(bad)-1] ^= 0x55
+	stream.Write(bad)
+	// A frame cut short by a new STX.
+	stream.Write([]byte{textSTX, '0', '1'})
+	stream.Write(compowayFrame(textReadCommand))
+	stream.Write(compowayFrame(textReadResponse))
+	m := NewMonitor()
+	NewTextDecoder(&stream).Run(m)
+	want := fmt.Sprint(map[Register]uint16{200: 0x16, 201: 0x2bc, 202: 0xffdd})
+	if got := registerValuesString(m.State()); got != want {
+		t.Errorf("decoded %s, want %s", got, want)
+	}
+}
+
+func TestMonitorReadWaitsForAllRegisters(t *testing.T) {
+	m := NewMonitor()
+	t0 := time.Date(2021, time.January, 1, 12, 0, 0, 0, time.UTC)
+	m.Observe(t0, 200, []uint16{1, 2})
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		m.Observe(t0.Add(time.Second), 143, []uint16{39})
+		time.Sleep(20 * time.Millisecond)
+		m.Observe(t0.Add(2*time.Second), 202, []uint16{3})
+	}()
+	s, err := m.read(context.Background(), []RegisterRange{{143, 143}, {200, 202}}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprint(map[Register]uint16{143: 39, 200: 1, 201: 2, 202: 3})
+	if got := registerValuesString(s); got != want {
+		t.Errorf("read %s, want %s", got, want)
+	}
+	if !s.CollectionTime().Equal(t0) {
+		t.Errorf("collection time %v, want that of the oldest value, %v", s.CollectionTime(), t0)
+	}
+
+	if _, err := m.read(context.Background(), []RegisterRange{{200, 203}}, 10*time.Millisecond); !errors.Is(err, ErrNoData) {
+		t.Errorf("read with register 203 never observed = %v, want ErrNoData", err)
+	}
+}
+
+// textReadExchange returns a read variable area command for the registers
+// from first, and its response holding values.
+func textReadExchange(first Register, values []uint16) (command, response string) {
+	command = fmt.Sprintf("01000"+"0101"+"82"+"%04X"+"00"+"%04X", uint16(first), len(values))
+	response = "0100" + "00" + "0101" + "0000"
+	for _, v := range values {
+		response += fmt.Sprintf("%04X", v)
+	}
+	return command, response
+}
+
+func TestMonitorReadGroupsFromTraffic(t *testing.T) {
+	// The bus master polls the named registers in runs, skipping the gaps
+	// in the register map, and now and then changes a setpoint.
+	var bodies []string
+	var run []uint16
+	var first Register
+	flush := func() {
+		if len(run) > 0 {
+			command, response := textReadExchange(first, run)
+			bodies = append(bodies, command, response)
+		}
+		run = nil
+	}
+	groups := append(Setpoints.Ranges, Sensors.Ranges...)
+	for _, info := range KnownRegisters() {
+		if !inRanges(groups, info.Register) {
+			continue
+		}
+		if len(run) > 0 && info.Register != first+Register(len(run)) {
+			flush()
+		}
+		if len(run) == 0 {
+			first = info.Register
+		}
+		run = append(run, uint16(info.Register))
+	}
+	flush()
+	bodies = append(bodies[:2], append([]string{textWriteCommand, textWriteResponse}, bodies[2:]...)...)
+
+	r, w := io.Pipe()
+	m := NewMonitor()
+	go NewTextDecoder(r).Run(m)
+	go func() {
+		for _, body := range bodies {
+			w.Write(compowayFrame(body))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	defer w.Close()
+
+	c := NewClient(&passiveTransport{r}, nil)
+	c.monitor = m
+	c.passiveTimeout = 5 * time.Second
+	s, err := c.ReadState(WithGroups(Setpoints, Sensors))
+	if err != nil {
+		t.Fatalf("ReadState = %v", err)
+	}
+	if got := s.registerValues[AmbientTemp]; got != uint16(AmbientTemp) {
+		t.Errorf("AmbientTemp = %d, want %d", got, uint16(AmbientTemp))
+	}
+	if got := s.registerValues[TargetACHeatingModeTemp]; got != 0x27 {
+		t.Errorf("TargetACHeatingModeTemp = %d, want the value written, %d", got, 0x27)
+	}
+	if _, ok := s.registerValues[207]; ok {
+		t.Errorf("unnamed register 207 has a value, but was never on the bus")
+	}
+}
@@ -0,0 +1,73 @@
+package cx34
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sodabrew/chilctl/units"
+)
+
+// stubbornTransport acknowledges the first ignore single register writes
+// without changing the register, as a heat pump does with a value it does
+// not accept.
+type stubbornTransport struct {
+	testTransport
+	ignore int
+}
+
+func (t *stubbornTransport) WriteSingleRegister(address, value uint16) ([]byte, error) {
+	t.mu.Lock()
+	if t.ignore > 0 {
+		t.ignore--
+		value = t.registers[address]
+	}
+	t.mu.Unlock()
+	return t.testTransport.WriteSingleRegister(address, value)
+}
+
+func TestWriteVerifyRetries(t *testing.T) {
+	tr := &stubbornTransport{ignore: 1}
+	tr.registers[TargetACHeatingModeTemp] = 39
+	c := NewClient(tr, &Params{VerifyWrites: true, Retry: RetryPolicy{Attempts: 3}})
+
+	if err := c.SetHeatingTemp(units.FromCelsius(40)); err != nil {
+		t.Fatalf("SetHeatingTemp = %v, want success on the second write", err)
+	}
+	if got := tr.registers[TargetACHeatingModeTemp]; got != 40 {
+		t.Errorf("heating setpoint = %d, want 40", got)
+	}
+	want := []string{"write 143", "read 143", "write 143", "read 143"}
+	if fmt.Sprint(tr.log) != fmt.Sprint(want) {
+		t.Errorf("requests = %v, want %v", tr.log, want)
+	}
+}
+
+func TestWriteVerifyFails(t *testing.T) {
+	tr := &stubbornTransport{ignore: 3}
+	tr.registers[TargetACHeatingModeTemp] = 39
+	c := NewClient(tr, &Params{VerifyWrites: true, Retry: RetryPolicy{Attempts: 3}})
+
+	err := c.SetHeatingTemp(units.FromCelsius(40))
+	if !errors.Is(err, ErrVerify) {
+		t.Fatalf("SetHeatingTemp = %v, want ErrVerify", err)
+	}
+	var mismatch *WriteMismatchError
+	if !errors.As(err, &mismatch) || mismatch.Register != TargetACHeatingModeTemp || mismatch.Wrote != 40 || mismatch.ReadBack != 39 {
+		t.Errorf("SetHeatingTemp = %#v, want register 143 wrote 40 read back 39", err)
+	}
+	if writes := len(tr.log) / 2; writes != 3 {
+		t.Errorf("wrote %d times, want 3: %v", writes, tr.log)
+	}
+}
+
+func TestWriteWithoutVerify(t *testing.T) {
+	tr := &stubbornTransport{ignore: 1}
+	c := NewClient(tr, nil)
+	if err := c.SetHeatingTemp(units.FromCelsius(40)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"write 143"}; fmt.Sprint(tr.log) != fmt.Sprint(want) {
+		t.Errorf("requests = %v, want %v", tr.log, want)
+	}
+}
@@ -0,0 +1,270 @@
+// Package cx34sim simulates a CX34 heat pump as a Modbus slave, so that
+// software using package cx34 can be tried out without touching a real
+// heat pump.
+//
+// A Device holds the holding registers described in package cx34 and runs a
+// simple thermal model: the compressor ramps up and down to reach the
+// setpoint, heat goes into a water loop or the hot water tank, and the loop
+// loses heat to the house. The setpoints 140-144 can be written over Modbus;
+// every other register is read-only. The model is only meant to make
+// temperatures, flow and power evolve plausibly, not to match a real unit.
+package cx34sim
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/sodabrew/chilctl/cx34"
+)
+
+const (
+	// Range of valid holding registers.
+	firstRegister = 1
+	lastRegister  = 350
+)
+
+// Model constants.
+const (
+	waterHeatCapacity = 4186.0 // J/(kg K)
+	loopMass          = 300.0  // kg of water in the heating loop
+	tankMass          = 200.0  // kg of water in the DHW tank
+	houseTemp         = 20.0   // °C
+	loopLoss          = 250.0  // W/K from the loop to the house
+	tankLoss          = 3.0    // W/K from the tank to the house
+
+	maxFrequency  = 90.0  // Hz
+	maxCapacity   = 10e3  // W of heat at maxFrequency
+	rampRate      = 1.0   // Hz/s
+	pumpFlow      = 20.0  // l/min
+	pumpPower     = 50.0  // W
+	lineVoltage   = 240.0 // V
+	dhwHysteresis = 5.0   // °C below the DHW setpoint that starts tank heating
+)
+
+// Device is a simulated CX34. It is safe for concurrent use.
+type Device struct {
+	// UnitID is the slave address the device answers to.
+	UnitID byte
+
+	mu        sync.Mutex
+	registers [lastRegister + 1]uint16
+
+	ambient      float64 // outdoor temperature, °C
+	loop         float64 // water loop temperature, °C
+	tank         float64 // DHW tank temperature, °C
+	outlet       float64 // water outlet temperature, °C
+	frequency    float64 // compressor frequency, Hz
+	flow         float64 // water flow, l/min
+	power        float64 // electrical input power, W
+	runningHours float64
+	heatingTank  bool
+}
+
+// New returns a device with unit id 1 that is heating, with the outdoor
+// temperature at ambient degrees Celsius.
+func New(ambient float64) *Device {
+	d := &Device{
+		UnitID:  1,
+		ambient: ambient,
+		loop:    houseTemp,
+		tank:    45,
+		outlet:  houseTemp,
+	}
+	d.registers[cx34.OnOffMode] = 1
+	d.registers[cx34.ACMode] = uint16(cx34.AirConditioningModeHeating)
+	d.registers[cx34.TargetACCoolingModeTemp] = 12
+	d.registers[cx34.TargetACHeatingModeTemp] = 39
+	d.registers[cx34.TargetDomesticHotWaterTemp] = 51
+	d.registers[cx34.ECWaterPumpMinimumSpeed] = 40
+	d.registers[cx34.FanType] = 1
+	d.registers[cx34.WaterPumpTypes] = 1
+	d.registers[cx34.DriverAllowedHighestFrequency] = maxFrequency
+	d.registers[cx34.InputACVoltage] = lineVoltage
+	d.update()
+	return d
+}
+
+// Run advances the model every tick until ctx is done. Simulated time runs
+// speed times faster than real time.
+func (d *Device) Run(ctx context.Context, tick time.Duration, speed float64) error {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			d.Step(time.Duration(float64(tick) * speed))
+		}
+	}
+}
+
+// Step advances the model by dt of simulated time.
+func (d *Device) Step(dt time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := dt.Seconds()
+
+	on := d.registers[cx34.OnOffMode] != 0
+	mode := cx34.AirConditioningMode(d.registers[cx34.ACMode])
+	dhwTarget := float64(d.registers[cx34.TargetDomesticHotWaterTemp])
+	dhw := mode == cx34.AirConditioningModeOnlyDHW || mode == cx34.AirConditioningModeHeatDHW || mode == cx34.AirConditioningModeCoolDHW
+	d.heatingTank = on && dhw && (d.tank < dhwTarget-dhwHysteresis || d.heatingTank && d.tank < dhwTarget)
+
+	// Work out what the compressor is trying to do.
+	var demand float64 // degrees short of the target
+	heating := true
+	water := d.loop
+	switch {
+	case !on:
+	case d.heatingTank:
+		water = d.tank
+		// The refrigerant must be hotter than the tank to heat it.
+		demand = dhwTarget + dhwHysteresis - d.tank
+	case mode == cx34.AirConditioningModeHeating, mode == cx34.AirConditioningModeHeatDHW:
+		demand = float64(d.registers[cx34.TargetACHeatingModeTemp]) - d.loop
+	case mode == cx34.AirConditioningModeCooling, mode == cx34.AirConditioningModeCoolDHW:
+		heating = false
+		demand = d.loop - float64(d.registers[cx34.TargetACCoolingModeTemp])
+	}
+	want := clamp(demand*15, 0, maxFrequency)
+	d.frequency += clamp(want-d.frequency, -rampRate*s, rampRate*s)
+	if d.frequency < 1 && want == 0 {
+		d.frequency = 0
+	}
+
+	d.flow = 0
+	if on {
+		d.flow = pumpFlow
+	}
+	heat := maxCapacity * d.frequency / maxFrequency
+	lift := math.Abs(d.outlet - d.ambient)
+	cop := clamp(6-0.08*lift, 1.5, 6)
+	d.power = heat / cop
+	if d.flow > 0 {
+		d.power += pumpPower
+	}
+	if d.frequency > 0 {
+		d.runningHours += dt.Hours()
+	}
+	if !heating {
+		heat = -heat
+	}
+
+	// Move the heat into the water, and let it leak out to the house.
+	if d.heatingTank {
+		d.tank += heat * s / (tankMass * waterHeatCapacity)
+	} else {
+		d.loop += heat * s / (loopMass * waterHeatCapacity)
+	}
+	d.loop -= loopLoss * (d.loop - houseTemp) * s / (loopMass * waterHeatCapacity)
+	d.tank -= tankLoss * (d.tank - houseTemp) * s / (tankMass * waterHeatCapacity)
+	d.outlet = water
+	if d.flow > 0 {
+		d.outlet += heat / (d.flow / 60 * waterHeatCapacity)
+	}
+	d.update()
+}
+
+// update sets the sensor registers from the model. Caller must hold the
+// mutex.
+func (d *Device) update() {
+	water := d.loop
+	if d.heatingTank {
+		water = d.tank
+	}
+	load := d.frequency / maxFrequency
+	current := d.power / lineVoltage
+
+	r := &d.registers
+	r[cx34.OutPipeTemp] = deciCelsius(d.ambient - 8*load)
+	r[cx34.CompressorDischargeTemp] = deciCelsius(d.outlet + 10 + 30*load)
+	r[cx34.AmbientTemp] = deciCelsius(d.ambient)
+	r[cx34.SuctionTemp] = deciCelsius(d.ambient - 2 - 6*load)
+	r[cx34.PlateHeatExchangerTemp] = deciCelsius(d.outlet - 1)
+	r[cx34.ACOutletWaterTemp] = deciCelsius(d.outlet)
+	r[cx34.WaterFlowRate] = uint16(math.Round(d.flow * 10))
+	r[cx34.CompressorFrequency] = uint16(math.Round(d.frequency))
+	r[cx34.OutdoorFanMotor] = onOff(d.frequency > 0)
+	r[cx34.C4WaterPump] = onOff(d.flow > 0)
+	r[cx34.InnerWaterFlowSwitch] = onOff(d.flow > 0)
+	r[cx34.OutdoorModularTemp] = deciCelsius(d.ambient + 2*load)
+	r[cx34.InnerPipeTemp] = deciCelsius(d.outlet - 2)
+	r[cx34.ECFanMotor1Speed] = uint16(math.Round(900 * load))
+	r[cx34.InternalPumpSpeed] = 0
+	if d.flow > 0 {
+		r[cx34.InternalPumpSpeed] = 6
+	}
+	r[cx34.InductorACCurrent] = deciUnits(current)
+	r[cx34.InputACCurrent] = deciUnits(current)
+	r[cx34.CompressorPhaseCurrent] = deciUnits(current * 0.9)
+	r[cx34.CompressorCurrentValueP15] = deciUnits(current * 0.9)
+	r[cx34.BusLineVoltage] = uint16(math.Round(lineVoltage * math.Sqrt2))
+	r[cx34.IPMTemp] = uint16(int16(math.Round(d.ambient + 20*load + 5)))
+	r[cx34.CompressorTotalRunningTime] = uint16(d.runningHours)
+	r[cx34.DomesticHotWaterTankTemp] = deciCelsius(d.tank)
+	r[cx34.WaterInletSensorTemp1] = deciCelsius(water)
+	r[cx34.WaterInletSensorTemp2] = deciCelsius(water)
+}
+
+// ReadRegisters returns the values of quantity registers starting at
+// address, or the Modbus exception code explaining why not.
+func (d *Device) ReadRegisters(address, quantity uint16) ([]uint16, byte) {
+	if quantity < 1 || quantity > 125 {
+		return nil, modbus.ExceptionCodeIllegalDataValue
+	}
+	if address < firstRegister || int(address)+int(quantity)-1 > lastRegister {
+		return nil, modbus.ExceptionCodeIllegalDataAddress
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	values := make([]uint16, quantity)
+	copy(values, d.registers[address:])
+	return values, 0
+}
+
+// WriteRegisters sets consecutive registers starting at address, or returns
+// the Modbus exception code explaining why not. Either all of the values
+// are written or none.
+func (d *Device) WriteRegisters(address uint16, values []uint16) byte {
+	if len(values) < 1 || len(values) > 123 {
+		return modbus.ExceptionCodeIllegalDataValue
+	}
+	for i, v := range values {
+		info, ok := cx34.LookupRegister(cx34.Register(int(address) + i))
+		if !ok || !info.Writable {
+			return modbus.ExceptionCodeIllegalDataAddress
+		}
+		if !info.InRange(v) {
+			return modbus.ExceptionCodeIllegalDataValue
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	copy(d.registers[address:], values)
+	return 0
+}
+
+// deciCelsius encodes a temperature in tenths of a degree, using two's
+// complement for temperatures below zero.
+func deciCelsius(c float64) uint16 {
+	return uint16(int16(math.Round(c * 10)))
+}
+
+func deciUnits(v float64) uint16 {
+	return uint16(math.Round(v * 10))
+}
+
+func onOff(b bool) uint16 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
@@ -0,0 +1,66 @@
+//go:build linux
+// +build linux
+
+package cx34sim
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// OpenPTY creates a pseudo-terminal and returns its master side, which the
+// device can serve with ServeRTU, and the path of its slave side, which a
+// client can open like a serial port.
+//
+// The slave side is also returned open; keep it open while serving, so that
+// reads from the master do not fail while no client has the slave open.
+func OpenPTY() (master *os.File, slavePath string, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer func() {
+		if err != nil {
+			master.Close()
+		}
+	}()
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		return nil, "", nil, fmt.Errorf("unlocking pty: %w", err)
+	}
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		return nil, "", nil, fmt.Errorf("getting pty number: %w", err)
+	}
+	slavePath = fmt.Sprintf("/dev/pts/%d", n)
+	slave, err = os.OpenFile(slavePath, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	// Pass bytes through untouched until a client sets its own mode.
+	var termios syscall.Termios
+	if err := ioctl(slave, syscall.TCGETS, unsafe.Pointer(&termios)); err != nil {
+		slave.Close()
+		return nil, "", nil, fmt.Errorf("getting pty attributes: %w", err)
+	}
+	termios.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	termios.Oflag &^= syscall.OPOST
+	termios.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	termios.Cflag &^= syscall.CSIZE | syscall.PARENB
+	termios.Cflag |= syscall.CS8
+	if err := ioctl(slave, syscall.TCSETS, unsafe.Pointer(&termios)); err != nil {
+		slave.Close()
+		return nil, "", nil, fmt.Errorf("setting pty attributes: %w", err)
+	}
+	return master, slavePath, slave, nil
+}
+
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package cx34sim
+
+import (
+	"errors"
+	"os"
+)
+
+// OpenPTY is only supported on Linux.
+func OpenPTY() (master *os.File, slavePath string, slave *os.File, err error) {
+	return nil, "", nil, errors.New("cx34sim: pseudo-terminals are only supported on Linux")
+}
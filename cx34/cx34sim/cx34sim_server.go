@@ -0,0 +1,198 @@
+package cx34sim
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/goburrow/modbus"
+	"github.com/golang/glog"
+	"github.com/howeyc/crc16"
+)
+
+const (
+	tcpHeaderSize = 7 // MBAP header
+	tcpMaxSize    = 260
+	rtuMaxSize    = 256
+)
+
+// ServeTCP accepts Modbus TCP connections on l and answers them until l is
+// closed.
+func (d *Device) ServeTCP(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := d.serveTCPConn(conn); err != nil && !errors.Is(err, io.EOF) {
+				glog.Warningf("Modbus TCP connection from %v: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (d *Device) serveTCPConn(conn io.ReadWriter) error {
+	var buf [tcpMaxSize]byte
+	for {
+		header := buf[:tcpHeaderSize]
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return err
+		}
+		length := int(binary.BigEndian.Uint16(header[4:]))
+		if length < 2 || tcpHeaderSize-1+length > tcpMaxSize {
+			return errors.New("invalid MBAP length")
+		}
+		pdu := buf[tcpHeaderSize : tcpHeaderSize-1+length]
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return err
+		}
+		// Gateways commonly address the device behind them as 0 or 255.
+		unit := header[6]
+		if unit != d.UnitID && unit != 0 && unit != 0xff {
+			continue
+		}
+		response := d.handle(pdu[0], pdu[1:])
+		adu := make([]byte, tcpHeaderSize, tcpHeaderSize+len(response))
+		copy(adu, header[:4])
+		binary.BigEndian.PutUint16(adu[4:], uint16(1+len(response)))
+		adu[6] = unit
+		if _, err := conn.Write(append(adu, response...)); err != nil {
+			return err
+		}
+	}
+}
+
+// ServeRTU answers Modbus RTU requests read from rw until reading fails.
+// Requests addressed to other units are ignored, and broadcasts are carried
+// out without answering.
+func (d *Device) ServeRTU(rw io.ReadWriter) error {
+	var buf []byte
+	chunk := make([]byte, rtuMaxSize)
+	for {
+		n, err := rw.Read(chunk)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, chunk[:n]...)
+		for {
+			length, ok := rtuRequestLength(buf)
+			if !ok {
+				break
+			}
+			if length == 0 || rtuChecksum(buf[:length-2]) != binary.LittleEndian.Uint16(buf[length-2:]) {
+				// Not a request we understand; resynchronize on the next byte.
+				buf = buf[1:]
+				continue
+			}
+			request := buf[:length]
+			buf = buf[length:]
+			unit := request[0]
+			if unit != d.UnitID && unit != 0 {
+				continue
+			}
+			response := d.handle(request[1], request[2:length-2])
+			if unit == 0 {
+				continue
+			}
+			adu := append([]byte{unit}, response...)
+			crc := rtuChecksum(adu)
+			if _, err := rw.Write(append(adu, byte(crc), byte(crc>>8))); err != nil {
+				return err
+			}
+		}
+		buf = append([]byte(nil), buf...)
+	}
+}
+
+// rtuRequestLength returns the length of the request frame starting with b,
+// or 0 if b cannot start a request. It returns false if more bytes are
+// needed to tell.
+func rtuRequestLength(b []byte) (int, bool) {
+	if len(b) < 2 {
+		return 0, false
+	}
+	length := 0
+	switch b[1] {
+	case modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeWriteSingleRegister:
+		length = 8
+	case modbus.FuncCodeWriteMultipleRegisters:
+		if len(b) < 7 {
+			return 0, false
+		}
+		length = 9 + int(b[6])
+	default:
+		// The length of other requests is not known, so the bytes received
+		// so far are taken to be one if their CRC is valid, as a slave does
+		// at the silence after a frame. handle answers it with an
+		// IllegalFunction exception.
+		if len(b) >= 4 && rtuChecksum(b[:len(b)-2]) == binary.LittleEndian.Uint16(b[len(b)-2:]) {
+			return len(b), true
+		}
+		return 0, true
+	}
+	if len(b) < length {
+		return 0, false
+	}
+	return length, true
+}
+
+func rtuChecksum(b []byte) uint16 {
+	return ^crc16.ChecksumIBM(b)
+}
+
+// handle carries out a request and returns the response PDU.
+func (d *Device) handle(functionCode byte, data []byte) []byte {
+	response, exception := d.handleData(functionCode, data)
+	if exception != 0 {
+		return []byte{functionCode | 0x80, exception}
+	}
+	return append([]byte{functionCode}, response...)
+}
+
+func (d *Device) handleData(functionCode byte, data []byte) ([]byte, byte) {
+	switch functionCode {
+	case modbus.FuncCodeReadHoldingRegisters:
+		if len(data) != 4 {
+			return nil, modbus.ExceptionCodeIllegalDataValue
+		}
+		values, exception := d.ReadRegisters(binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:]))
+		if exception != 0 {
+			return nil, exception
+		}
+		response := []byte{byte(2 * len(values))}
+		for _, v := range values {
+			response = binary.BigEndian.AppendUint16(response, v)
+		}
+		return response, 0
+
+	case modbus.FuncCodeWriteSingleRegister:
+		if len(data) != 4 {
+			return nil, modbus.ExceptionCodeIllegalDataValue
+		}
+		if exception := d.WriteRegisters(binary.BigEndian.Uint16(data), []uint16{binary.BigEndian.Uint16(data[2:])}); exception != 0 {
+			return nil, exception
+		}
+		return data, 0
+
+	case modbus.FuncCodeWriteMultipleRegisters:
+		if len(data) < 5 {
+			return nil, modbus.ExceptionCodeIllegalDataValue
+		}
+		quantity := int(binary.BigEndian.Uint16(data[2:]))
+		if int(data[4]) != 2*quantity || len(data) != 5+2*quantity {
+			return nil, modbus.ExceptionCodeIllegalDataValue
+		}
+		values := make([]uint16, quantity)
+		for i := range values {
+			values[i] = binary.BigEndian.Uint16(data[5+2*i:])
+		}
+		if exception := d.WriteRegisters(binary.BigEndian.Uint16(data), values); exception != 0 {
+			return nil, exception
+		}
+		return data[:4], 0
+	}
+	return nil, modbus.ExceptionCodeIllegalFunction
+}
@@ -0,0 +1,110 @@
+package cx34sim
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/sodabrew/chilctl/cx34"
+	"github.com/sodabrew/chilctl/units"
+)
+
+func serveTCP(t *testing.T, d *Device) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go d.ServeTCP(l)
+	return l.Addr().String()
+}
+
+func TestClientOverTCP(t *testing.T) {
+	d := New(-10)
+	addr := serveTCP(t, d)
+	c, err := cx34.Connect(&cx34.Params{Mode: cx34.Modbus, Address: "tcp://" + addr, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s, err := c.ReadState(cx34.WithGroups(cx34.Setpoints, cx34.Sensors))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.ACHeatingTargetTemp().Celsius(); got != 39 {
+		t.Errorf("heating setpoint = %v°C, want 39", got)
+	}
+	if got := s.AmbientTemp().Celsius(); got != -10 {
+		t.Errorf("ambient = %v°C, want -10", got)
+	}
+
+	if err := c.SetHeatingTemp(units.FromCelsius(45)); err != nil {
+		t.Fatalf("SetHeatingTemp = %v", err)
+	}
+	mode := cx34.AirConditioningModeHeatDHW
+	dhw := units.FromCelsius(55)
+	if err := c.ApplySettings(&cx34.Settings{Mode: &mode, DHWTemp: &dhw}); err != nil {
+		t.Fatalf("ApplySettings = %v", err)
+	}
+	s, err = c.ReadState(cx34.WithGroups(cx34.Setpoints))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ACHeatingTargetTemp().Celsius() != 45 || s.ACMode() != mode || s.DomesticHotWaterTargetTemp().Celsius() != 55 {
+		t.Errorf("setpoints after writing = %v", s.RegisterValues())
+	}
+}
+
+func TestIllegalFunctionOverTCP(t *testing.T) {
+	addr := serveTCP(t, New(5))
+	handler := modbus.NewTCPClientHandler(addr)
+	handler.SlaveId = 1
+	handler.Timeout = time.Second
+	defer handler.Close()
+	_, err := modbus.NewClient(handler).ReadInputRegisters(200, 1)
+	var modbusErr *modbus.ModbusError
+	if !errors.As(err, &modbusErr) || modbusErr.ExceptionCode != modbus.ExceptionCodeIllegalFunction {
+		t.Errorf("ReadInputRegisters = %v, want exception %d", err, modbus.ExceptionCodeIllegalFunction)
+	}
+}
+
+func TestIllegalFunctionOverRTU(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go New(5).ServeRTU(server)
+	defer server.Close()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	tests := []struct {
+		name    string
+		request []byte
+		want    []byte
+	}{
+		// Read input registers 200, 1 register.
+		{"read input registers", []byte{0x01, 0x04, 0x00, 0xc8, 0x00, 0x01}, []byte{0x01, 0x84, 0x01}},
+		// Read device identification, of a length the device cannot know.
+		{"read device identification", []byte{0x01, 0x2b, 0x0e, 0x01, 0x00}, []byte{0x01, 0xab, 0x01}},
+		// A known function code still works afterwards.
+		{"read holding register", []byte{0x01, 0x03, 0x00, 0x8f, 0x00, 0x01}, []byte{0x01, 0x03, 0x02, 0x00, 39}},
+	}
+	for _, tt := range tests {
+		request := binary.LittleEndian.AppendUint16(tt.request, rtuChecksum(tt.request))
+		if _, err := client.Write(request); err != nil {
+			t.Fatal(err)
+		}
+		want := binary.LittleEndian.AppendUint16(tt.want, rtuChecksum(tt.want))
+		got := make([]byte, len(want))
+		if _, err := io.ReadFull(client, got); err != nil {
+			t.Fatalf("%s: reading response: %v", tt.name, err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s: response % x, want % x", tt.name, got, want)
+		}
+	}
+}
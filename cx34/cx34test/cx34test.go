@@ -0,0 +1,165 @@
+// Package cx34test provides helpers for testing code that uses package cx34
+// without a heat pump: States built from register values, a fake Transport
+// that records writes, and register dumps of heat pumps.
+package cx34test
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/sodabrew/chilctl/cx34"
+)
+
+// NewState returns a State holding values, collected now.
+func NewState(values map[cx34.Register]uint16) *cx34.State {
+	return cx34.NewState(time.Now(), values)
+}
+
+// Write is a write recorded by FakeTransport.
+type Write struct {
+	// First is the first register written.
+	First cx34.Register
+	// Values holds the values written to First and the registers after it.
+	Values []uint16
+	// Multiple is true for WriteMultipleRegisters, false for
+	// WriteSingleRegister.
+	Multiple bool
+}
+
+// FakeTransport is a cx34.Transport backed by a map of register values. It
+// records every read and write, and is safe for concurrent use.
+type FakeTransport struct {
+	mu        sync.Mutex
+	registers map[cx34.Register]uint16
+	reads     []cx34.RegisterRange
+	writes    []Write
+	err       error
+
+	// Failures injected by FailWrite and IgnoreWrites.
+	writeCount  int
+	failWrites  map[int]error
+	ignoreWrite map[cx34.Register]bool
+}
+
+// NewFakeTransport returns a FakeTransport holding the register values of
+// s, or none if s is nil. Registers without a value read as zero.
+func NewFakeTransport(s *cx34.State) *FakeTransport {
+	t := &FakeTransport{registers: make(map[cx34.Register]uint16)}
+	if s != nil {
+		for reg, v := range s.RegisterValues() {
+			t.registers[reg] = v
+		}
+	}
+	return t
+}
+
+// SetError makes every following call fail with err, or succeed again if
+// err is nil.
+func (t *FakeTransport) SetError(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.err = err
+}
+
+// FailWrite makes the nth write, counting from 1 for the first write made
+// on t, fail with err without changing any register.
+func (t *FakeTransport) FailWrite(n int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failWrites == nil {
+		t.failWrites = make(map[int]error)
+	}
+	t.failWrites[n] = err
+}
+
+// IgnoreWrites makes writes to regs succeed without changing them, as a heat
+// pump does with values it does not accept.
+func (t *FakeTransport) IgnoreWrites(regs ...cx34.Register) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ignoreWrite == nil {
+		t.ignoreWrite = make(map[cx34.Register]bool)
+	}
+	for _, reg := range regs {
+		t.ignoreWrite[reg] = true
+	}
+}
+
+// State returns the current register values.
+func (t *FakeTransport) State() *cx34.State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return cx34.NewState(time.Now(), t.registers)
+}
+
+// Reads returns the registers read by each ReadHoldingRegisters call so far,
+// oldest first.
+func (t *FakeTransport) Reads() []cx34.RegisterRange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]cx34.RegisterRange(nil), t.reads...)
+}
+
+// Writes returns the writes made so far, oldest first. Writes failed by
+// FailWrite are left out.
+func (t *FakeTransport) Writes() []Write {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Write(nil), t.writes...)
+}
+
+// ReadHoldingRegisters implements cx34.Transport.
+func (t *FakeTransport) ReadHoldingRegisters(address, quantity uint16) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return nil, t.err
+	}
+	t.reads = append(t.reads, cx34.RegisterRange{First: cx34.Register(address), Last: cx34.Register(int(address) + int(quantity) - 1)})
+	results := make([]byte, 2*int(quantity))
+	for i := 0; i < int(quantity); i++ {
+		binary.BigEndian.PutUint16(results[2*i:], t.registers[cx34.Register(int(address)+i)])
+	}
+	return results, nil
+}
+
+// WriteSingleRegister implements cx34.Transport.
+func (t *FakeTransport) WriteSingleRegister(address, value uint16) ([]byte, error) {
+	return t.write(address, []uint16{value}, false)
+}
+
+// WriteMultipleRegisters implements cx34.Transport.
+func (t *FakeTransport) WriteMultipleRegisters(address, quantity uint16, value []byte) ([]byte, error) {
+	values := make([]uint16, quantity)
+	for i := range values {
+		values[i] = binary.BigEndian.Uint16(value[2*i:])
+	}
+	return t.write(address, values, true)
+}
+
+func (t *FakeTransport) write(address uint16, values []uint16, multiple bool) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return nil, t.err
+	}
+	t.writeCount++
+	if err := t.failWrites[t.writeCount]; err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		reg := cx34.Register(int(address) + i)
+		if !t.ignoreWrite[reg] {
+			t.registers[reg] = v
+		}
+	}
+	t.writes = append(t.writes, Write{cx34.Register(address), values, multiple})
+	results := make([]byte, 4)
+	binary.BigEndian.PutUint16(results, address)
+	binary.BigEndian.PutUint16(results[2:], values[0])
+	if multiple {
+		binary.BigEndian.PutUint16(results[2:], uint16(len(values)))
+	}
+	return results, nil
+}
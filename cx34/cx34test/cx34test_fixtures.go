@@ -0,0 +1,84 @@
+package cx34test
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sodabrew/chilctl/cx34"
+)
+
+// fixtureTime is the collection time of the States made from fixtures, so
+// that they are the same every time.
+var fixtureTime = time.Date(2021, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+//go:embed fixtures/*.json
+var fixtureFiles embed.FS
+
+// Fixture is a dump of the holding registers of a heat pump in a known
+// condition.
+type Fixture struct {
+	Name        string `json:"-"`
+	Description string `json:"description"`
+	// Recorded is true for dumps read from a real unit, and false for
+	// values made up to resemble one.
+	Recorded  bool                     `json:"recorded"`
+	Registers map[cx34.Register]uint16 `json:"registers"`
+}
+
+// State returns a State holding the register values of the fixture.
+func (f *Fixture) State() *cx34.State {
+	return cx34.NewState(fixtureTime, f.Registers)
+}
+
+// Transport returns a FakeTransport holding the register values of the
+// fixture.
+func (f *Fixture) Transport() *FakeTransport {
+	return NewFakeTransport(f.State())
+}
+
+// FixtureNames returns the names of the available fixtures: "heating",
+// recorded from a real unit, and "cold", which is synthesized and holds
+// negative temperatures, for checking that they are decoded as such rather
+// than as values around 6500℃. There are no fixtures yet for cooling,
+// heating domestic hot water, defrost or a fault; they will be added as
+// recordings of a unit in those conditions become available, since made-up
+// values would only test the code against its own assumptions.
+func FixtureNames() []string {
+	entries, err := fixtureFiles.ReadDir("fixtures")
+	if err != nil {
+		panic(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadFixture returns the fixture called name.
+func LoadFixture(name string) (*Fixture, error) {
+	data, err := fixtureFiles.ReadFile(path.Join("fixtures", name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("unknown fixture %q", name)
+	}
+	f := &Fixture{Name: name}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("fixture %q: %w", name, err)
+	}
+	return f, nil
+}
+
+// MustLoadFixture is like LoadFixture but panics on error.
+func MustLoadFixture(name string) *Fixture {
+	f, err := LoadFixture(name)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
@@ -0,0 +1,89 @@
+package cx34test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sodabrew/chilctl/cx34"
+)
+
+func TestFixturesReadThroughClient(t *testing.T) {
+	names := FixtureNames()
+	if len(names) == 0 {
+		t.Fatal("no fixtures")
+	}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			f, err := LoadFixture(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Description == "" {
+				t.Errorf("fixture has no description")
+			}
+			c := cx34.NewClient(f.Transport(), nil)
+			s, err := c.ReadState()
+			if err != nil {
+				t.Fatalf("ReadState = %v", err)
+			}
+			got := s.RegisterValues()
+			for reg, want := range f.Registers {
+				if got[reg] != want {
+					t.Errorf("register %d = %d, want %d", uint16(reg), got[reg], want)
+				}
+			}
+			if got, want := s.ACHeatingTargetTemp(), f.State().ACHeatingTargetTemp(); got != want {
+				t.Errorf("ACHeatingTargetTemp = %v, want %v", got, want)
+			}
+		})
+	}
+	if _, err := LoadFixture("no-such-fixture"); err == nil {
+		t.Errorf("LoadFixture of an unknown name succeeded")
+	}
+}
+
+func TestFakeTransportWrites(t *testing.T) {
+	tr := NewFakeTransport(nil)
+	errFailed := errors.New("failed")
+	tr.FailWrite(2, errFailed)
+	tr.IgnoreWrites(cx34.TargetDomesticHotWaterTemp)
+
+	if _, err := tr.WriteSingleRegister(143, 40); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.WriteSingleRegister(143, 41); !errors.Is(err, errFailed) {
+		t.Errorf("second write = %v, want the injected failure", err)
+	}
+	if _, err := tr.WriteMultipleRegisters(143, 2, []byte{0, 42, 0, 50}); err != nil {
+		t.Fatal(err)
+	}
+	values := tr.State().RegisterValues()
+	if values[143] != 42 || values[144] != 0 {
+		t.Errorf("registers 143, 144 = %d, %d, want 42 and 144 unchanged at 0", values[143], values[144])
+	}
+	var got []string
+	for _, w := range tr.Writes() {
+		got = append(got, fmt.Sprintf("%d:%v:%t", uint16(w.First), w.Values, w.Multiple))
+	}
+	want := "[143:[40]:false 143:[42 50]:true]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("writes = %v, want %s", got, want)
+	}
+
+	tr.SetError(errFailed)
+	if _, err := tr.ReadHoldingRegisters(143, 1); !errors.Is(err, errFailed) {
+		t.Errorf("read after SetError = %v, want the error set", err)
+	}
+}
+
+func TestColdFixtureIsBelowZero(t *testing.T) {
+	c := cx34.NewClient(MustLoadFixture("cold").Transport(), nil)
+	s, err := c.ReadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.AmbientTemp().Celsius(); got >= 0 || got < -40 {
+		t.Errorf("AmbientTemp = %v, want a few degrees below zero", s.AmbientTemp())
+	}
+}
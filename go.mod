@@ -8,5 +8,4 @@ require (
 	github.com/golang/glog v1.1.1
 	github.com/howeyc/crc16 v0.0.0-20171223171357-2b2a61e366a6
 	github.com/martinlindhe/unit v0.0.0-20230420213220-4adfd7d0a0d6
-	go.uber.org/multierr v1.11.0
 )
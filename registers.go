@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sodabrew/chilctl/cx34"
+)
+
+var registersFlags = flag.NewFlagSet("registers", flag.ContinueOnError)
+
+// runRegisters prints what is known about each holding register.
+func runRegisters() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "REGISTER\tNAME\tUNIT\tSCALE\tSIGNED\tRANGE\tWRITABLE\tDESCRIPTION\n")
+	for _, info := range cx34.KnownRegisters() {
+		scale := info.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		valid := ""
+		if info.Min != 0 || info.Max != 0 {
+			valid = fmt.Sprintf("%g to %g", info.Min, info.Max)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%g\t%t\t%s\t%t\t%s\n",
+			info.Register, info.Name, info.Unit, scale, info.Signed, valid, info.Writable, info.Description)
+	}
+	w.Flush()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/sodabrew/chilctl/cx34"
+)
+
+var (
+	scanFlags   = flag.NewFlagSet("scan", flag.ContinueOnError)
+	scanTimeout = scanFlags.Duration("scan-timeout", 250*time.Millisecond, "How long the scan command waits for each unit id to answer.")
+	scanFirst   = scanFlags.Int("scan-first", cx34.FirstUnitID, "First unit id probed by the scan command.")
+	scanLast    = scanFlags.Int("scan-last", cx34.LastUnitID, "Last unit id probed by the scan command.")
+)
+
+// runScan probes the bus for heat pumps and prints the unit ids that answer.
+func runScan(params *cx34.Params) {
+	params.Timeout = *scanTimeout
+	fmt.Printf("Scanning unit ids %d-%d, this may take up to %v...\n",
+		*scanFirst, *scanLast, time.Duration(*scanLast-*scanFirst+1)**scanTimeout)
+	found, err := cx34.Scan(context.Background(), params, *scanFirst, *scanLast)
+	if err != nil {
+		glog.Errorf("error scanning for CX34 units: %v", err)
+		return
+	}
+	if len(found) == 0 {
+		fmt.Printf("No units responded.\n")
+		return
+	}
+	for _, result := range found {
+		fmt.Printf("%v\n", result)
+	}
+}
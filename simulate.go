@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/sodabrew/chilctl/cx34/cx34sim"
+)
+
+var (
+	simFlags   = flag.NewFlagSet("simulate", flag.ContinueOnError)
+	simTCP     = simFlags.String("sim-tcp", "", "Address on which the simulate command serves Modbus TCP, e.g. :5020.")
+	simPTY     = simFlags.Bool("sim-pty", true, "Whether the simulate command serves Modbus RTU on a pseudo-terminal.")
+	simAmbient = simFlags.Float64("sim-ambient", 5, "Outdoor temperature of the simulated heat pump, in degrees Celsius.")
+	simSpeed   = simFlags.Float64("sim-speed", 1, "How many times faster than real time the simulated heat pump runs.")
+)
+
+// runSimulate runs a simulated heat pump until interrupted.
+func runSimulate(unitId int) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	device := cx34sim.New(*simAmbient)
+	device.UnitID = byte(unitId)
+	serving := false
+
+	if *simPTY {
+		master, slavePath, slave, err := cx34sim.OpenPTY()
+		if err != nil {
+			glog.Errorf("error creating pseudo-terminal: %v", err)
+			return
+		}
+		defer master.Close()
+		defer slave.Close()
+		go func() {
+			err := device.ServeRTU(master)
+			if ctx.Err() == nil {
+				glog.Errorf("error serving Modbus RTU: %v", err)
+			}
+		}()
+		fmt.Printf("Serving Modbus RTU unit %d on %s, connect with -tty %s\n", unitId, slavePath, slavePath)
+		serving = true
+	}
+
+	if *simTCP != "" {
+		l, err := net.Listen("tcp", *simTCP)
+		if err != nil {
+			glog.Errorf("error listening for Modbus TCP: %v", err)
+			return
+		}
+		defer l.Close()
+		go func() {
+			err := device.ServeTCP(l)
+			if ctx.Err() == nil {
+				glog.Errorf("error serving Modbus TCP: %v", err)
+			}
+		}()
+		fmt.Printf("Serving Modbus TCP unit %d on %v, connect with -addr tcp://%v\n", unitId, l.Addr(), l.Addr())
+		serving = true
+	}
+
+	if !serving {
+		glog.Errorf("nothing to serve, use -sim-pty or -sim-tcp")
+		return
+	}
+	fmt.Printf("Press Ctrl-C to stop.\n")
+	device.Run(ctx, time.Second, *simSpeed)
+}
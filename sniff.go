@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/sodabrew/chilctl/cx34"
+)
+
+var (
+	sniffFlags    = flag.NewFlagSet("sniff", flag.ContinueOnError)
+	sniffInterval = sniffFlags.Duration("sniff-interval", 30*time.Second, "How often the sniff command prints the state observed on the bus.")
+)
+
+// runSniff listens to the bus until interrupted and periodically prints the
+// state of every unit seen in the traffic of another bus master.
+func runSniff(params *cx34.Params) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	sniffer := cx34.NewSniffer(params.BaudRate)
+	if params.Capture != nil {
+		sniffer.SetCapture(params.Capture)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cx34.Sniff(ctx, params, sniffer)
+	}()
+	fmt.Printf("Listening on %s, press Ctrl-C to stop...\n", params.TTYDevice)
+
+	ticker := time.NewTicker(*sniffInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			printSniffed(sniffer)
+		case err := <-done:
+			if err != nil && !errors.Is(err, context.Canceled) {
+				glog.Errorf("error listening to CX34 bus: %v", err)
+			}
+			printSniffed(sniffer)
+			return
+		}
+	}
+}
+
+// printSniffed prints the state observed so far for each unit.
+func printSniffed(sniffer *cx34.Sniffer) {
+	units := sniffer.Units()
+	if len(units) == 0 {
+		fmt.Printf("No register values observed yet.\n")
+		return
+	}
+	for _, unitId := range units {
+		state := sniffer.State(unitId)
+		if *rawFlag {
+			fmt.Printf("%+v\n", state)
+		} else {
+			printState(state, unitId)
+		}
+	}
+}